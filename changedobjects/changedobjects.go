@@ -0,0 +1,408 @@
+package changedobjects
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/babarot/changed-objects/internal/detect"
+	"github.com/babarot/changed-objects/internal/git"
+)
+
+// IgnoreFileName is the conventional name of the gitignore-style file given
+// to WithIgnoreFile.
+const IgnoreFileName = detect.IgnoreFileName
+
+// ResolvedFromBase is Dir.ResolvedFrom for a dir whose root marker was found
+// in the base commit instead of the working tree, e.g. a deleted one.
+const ResolvedFromBase = detect.ResolvedFromBase
+
+// DirExist filters changes by whether their parent directory exists.
+type DirExist string
+
+const (
+	DirExistAll   DirExist = "all"
+	DirExistTrue  DirExist = "true"
+	DirExistFalse DirExist = "false"
+)
+
+// Detector computes a Diff. Create it with New.
+type Detector struct {
+	path    string
+	paths   []string
+	changes []Change
+	given   bool
+	opt     detect.Option
+}
+
+// Option configures a Detector.
+type Option func(*Detector)
+
+// New returns a Detector for the git repository at path. The repository is
+// not opened until Run is called.
+func New(path string, opts ...Option) (*Detector, error) {
+	d := &Detector{
+		path: path,
+		opt: detect.Option{
+			DefaultBranch: "main",
+			DirExist:      string(DirExistAll),
+		},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	// changes are relative to the repository root, whatever the current
+	// directory is
+	if filepath.IsAbs(d.opt.RootMarkerCeiling) {
+		root, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		ceiling, err := filepath.Rel(root, d.opt.RootMarkerCeiling)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root-marker ceiling: %w", err)
+		}
+		if err := detect.ValidateRootMarkerCeiling(ceiling); err != nil {
+			return nil, fmt.Errorf("root-marker ceiling %q is outside the repository %q", d.opt.RootMarkerCeiling, root)
+		}
+		d.opt.RootMarkerCeiling = ceiling
+	} else if err := detect.ValidateRootMarkerCeiling(d.opt.RootMarkerCeiling); err != nil {
+		return nil, err
+	}
+	switch DirExist(d.opt.DirExist) {
+	case DirExistAll, DirExistTrue, DirExistFalse:
+	default:
+		return nil, fmt.Errorf("invalid dir-exist state: %q", d.opt.DirExist)
+	}
+	return d, nil
+}
+
+// WithDefaultBranch sets the name of the default branch (main by default).
+func WithDefaultBranch(name string) Option {
+	return func(d *Detector) {
+		d.opt.DefaultBranch = name
+	}
+}
+
+// WithMergeBase compares with the merge-base of ref and HEAD.
+func WithMergeBase(ref string) Option {
+	return func(d *Detector) {
+		d.opt.MergeBase = ref
+	}
+}
+
+// WithPaths keeps only changes to the given paths or under the given
+// directories. Paths match on component boundaries, so "app" does not
+// match "application/main.go".
+func WithPaths(paths ...string) Option {
+	return func(d *Detector) {
+		d.paths = append(d.paths, paths...)
+	}
+}
+
+// WithTypes keeps only changes of the given types.
+func WithTypes(types ...ChangeType) Option {
+	return func(d *Detector) {
+		for _, ty := range types {
+			d.opt.Types = append(d.opt.Types, ty.String())
+		}
+	}
+}
+
+// WithIncludes keeps only changes whose path matches one of the given
+// doublestar patterns, e.g. "**/*.tf". Ignore patterns win over them.
+func WithIncludes(patterns ...string) Option {
+	return func(d *Detector) {
+		d.opt.Includes = append(d.opt.Includes, patterns...)
+	}
+}
+
+// WithIgnores skips changes matching the given gitignore-style patterns.
+// They are evaluated after the ones of WithIgnoreFile, so a pattern starting
+// with ! can re-include a path ignored there.
+func WithIgnores(patterns ...string) Option {
+	return func(d *Detector) {
+		d.opt.Ignores = append(d.opt.Ignores, patterns...)
+	}
+}
+
+// WithIgnoreFile skips changes matching the patterns in the given
+// gitignore-style file, e.g. .changedignore.
+func WithIgnoreFile(path string) Option {
+	return func(d *Detector) {
+		d.opt.IgnoreFile = path
+	}
+}
+
+// WithGroupBy groups changes into the directories matching the given
+// patterns. A pattern may be prefixed with a priority, e.g.
+// "10:kubernetes/**/overlays/*": matches of higher priority are preferred.
+func WithGroupBy(patterns ...string) Option {
+	return func(d *Detector) {
+		d.opt.GroupBy = append(d.opt.GroupBy, patterns...)
+	}
+}
+
+// GroupByMatch chooses among the ancestors of a change matched by the
+// WithGroupBy patterns.
+type GroupByMatch string
+
+const (
+	// MatchShortest groups into the shallowest matching ancestor.
+	MatchShortest GroupByMatch = detect.MatchShortest
+	// MatchLongest groups into the deepest matching ancestor.
+	MatchLongest GroupByMatch = detect.MatchLongest
+)
+
+// WithGroupByMatch sets how to choose among the matching ancestors of the
+// same priority (MatchShortest by default).
+func WithGroupByMatch(match GroupByMatch) Option {
+	return func(d *Detector) {
+		d.opt.GroupByMatch = string(match)
+	}
+}
+
+// WithDepth groups each change by its ancestor at the given depth instead of
+// by group-by patterns, e.g. terraform/a/prod for terraform/a/prod/x/y.tf at
+// depth 3. Changes in shallower directories are grouped by their parent
+// directory.
+func WithDepth(depth int) Option {
+	return func(d *Detector) {
+		d.opt.Depth = depth
+	}
+}
+
+// WithDepthFrom makes WithDepth count the depth below prefix.
+func WithDepthFrom(prefix string) Option {
+	return func(d *Detector) {
+		d.opt.DepthFrom = prefix
+	}
+}
+
+// Collapse decides what to do with a dir nested in another dir.
+type Collapse string
+
+const (
+	// CollapseNone reports nested dirs as they are.
+	CollapseNone Collapse = detect.CollapseNone
+	// CollapseAncestor merges the files of nested dirs into their topmost
+	// ancestor.
+	CollapseAncestor Collapse = detect.CollapseAncestor
+	// CollapseDescendant keeps only the dirs that have no nested dirs.
+	CollapseDescendant Collapse = detect.CollapseDescendant
+)
+
+// WithCollapse sets how to handle dirs nested in other dirs
+// (CollapseNone by default).
+func WithCollapse(mode Collapse) Option {
+	return func(d *Detector) {
+		d.opt.Collapse = string(mode)
+	}
+}
+
+// WithDirExist filters changes by the existence of their parent directory.
+func WithDirExist(state DirExist) Option {
+	return func(d *Detector) {
+		d.opt.DirExist = string(state)
+	}
+}
+
+// WithRootMarker groups changes into the nearest ancestor directory
+// containing a file matching one of markers (e.g. *.tf). A marker may be
+// followed by a colon and a regular expression the file content has to match
+// (e.g. *.tf:^terraform). Earlier markers take precedence over later ones.
+func WithRootMarker(markers ...string) Option {
+	return func(d *Detector) {
+		d.opt.RootMarkers = append(d.opt.RootMarkers, markers...)
+	}
+}
+
+// ExistFrom is where the existence of dirs and root markers is checked.
+type ExistFrom string
+
+const (
+	// ExistFromWorktree checks the working tree of the current directory.
+	ExistFromWorktree ExistFrom = detect.ExistFromWorktree
+	// ExistFromHead checks the tree of HEAD.
+	ExistFromHead ExistFrom = detect.ExistFromHead
+)
+
+// WithExistFrom sets where Dir.Exist and ParentDir.Exist are computed from
+// (ExistFromWorktree by default). Using a commit tree makes the result
+// independent of what is checked out, but cannot be combined with
+// WithChanges.
+func WithExistFrom(source ExistFrom) Option {
+	return func(d *Detector) {
+		d.opt.ExistFrom = string(source)
+	}
+}
+
+// SortKey orders the files and dirs of a Diff. Ties are broken by path.
+type SortKey string
+
+const (
+	// SortPath orders by path.
+	SortPath SortKey = detect.SortPath
+	// SortType orders by the type of change: additions, deletions, then
+	// modifications. A dir is ordered by the first type of its files.
+	SortType SortKey = detect.SortType
+	// SortSize puts the largest files first. A dir is as large as the sum
+	// of its files.
+	SortSize SortKey = detect.SortSize
+	// SortChanges puts the dirs with the most changed files first.
+	SortChanges SortKey = detect.SortChanges
+)
+
+// WithSort sets how files and dirs are ordered (SortPath by default).
+func WithSort(key SortKey) Option {
+	return func(d *Detector) {
+		d.opt.Sort = string(key)
+	}
+}
+
+// WithReverse reverses the order of files and dirs.
+func WithReverse(reverse bool) Option {
+	return func(d *Detector) {
+		d.opt.Reverse = reverse
+	}
+}
+
+// WithRootMarkerCeiling stops looking up root markers above dir, which
+// defaults to the repository root. dir itself is searched. A relative dir is
+// relative to the repository root. New fails if dir is above the root.
+func WithRootMarkerCeiling(dir string) Option {
+	return func(d *Detector) {
+		d.opt.RootMarkerCeiling = dir
+	}
+}
+
+// WithRootMarkerMaxDepth limits the number of directories searched for root
+// markers, starting from the dir of a change. 1 searches the dir only, 0 (the
+// default) has no limit.
+func WithRootMarkerMaxDepth(depth int) Option {
+	return func(d *Detector) {
+		d.opt.RootMarkerMaxDepth = depth
+	}
+}
+
+// WithShards partitions the dirs into n shards balanced by their weights,
+// which are the numbers of their files unless given with WithShardWeight.
+// Each Dir reports its shard, and the same dirs always get the same shards.
+func WithShards(n int) Option {
+	return func(d *Detector) {
+		d.opt.Shards = n
+	}
+}
+
+// WithShardIndex keeps only the dirs in the shard at index, from 0 to the
+// number of shards minus one, and their files.
+func WithShardIndex(index int) Option {
+	return func(d *Detector) {
+		d.opt.ShardIndex = &index
+	}
+}
+
+// WithShardWeight sets the weight of the dirs matching glob patterns for
+// WithShards, written as <pattern>=<weight>. The first matching pattern
+// wins.
+func WithShardWeight(weights ...string) Option {
+	return func(d *Detector) {
+		d.opt.ShardWeights = append(d.opt.ShardWeights, weights...)
+	}
+}
+
+// WithChanges makes the Detector work on the given changes instead of
+// comparing git commits. See also ParseChanges.
+func WithChanges(changes []Change) Option {
+	return func(d *Detector) {
+		d.changes = changes
+		d.given = true
+	}
+}
+
+// Run computes the Diff. The git operations and the grouping stop once ctx
+// is done, in which case the returned error is a *PhaseError.
+func (d *Detector) Run(ctx context.Context) (Diff, error) {
+	if d.given {
+		c, err := detect.NewWithChanges(d.paths, gitChanges(d.changes), d.opt)
+		if err != nil {
+			return Diff{}, err
+		}
+		diff, err := c.Run(ctx)
+		return newDiff(diff), publicError(err)
+	}
+
+	c, err := detect.New(ctx, d.path, d.paths, d.opt)
+	if err != nil {
+		return Diff{}, publicError(err)
+	}
+	diff, err := c.Run(ctx)
+	return newDiff(diff), publicError(err)
+}
+
+// Walk is like Run but calls fn with each File and then each Dir, in the
+// same order as Run returns them, instead of returning a Diff. The files and
+// dirs are still computed in full before fn is called. It stops at the first
+// error returned by fn.
+func (d *Detector) Walk(ctx context.Context, fn func(Entry) error) error {
+	walk := func(e detect.Entry) error {
+		return fn(newEntry(e))
+	}
+	if d.given {
+		c, err := detect.NewWithChanges(d.paths, gitChanges(d.changes), d.opt)
+		if err != nil {
+			return err
+		}
+		return publicError(c.Walk(ctx, walk))
+	}
+
+	c, err := detect.New(ctx, d.path, d.paths, d.opt)
+	if err != nil {
+		return publicError(err)
+	}
+	return publicError(c.Walk(ctx, walk))
+}
+
+// Explain is like Run but returns, for every changed file, the decisions
+// made by each filter and by the grouping.
+func (d *Detector) Explain(ctx context.Context) ([]Explanation, error) {
+	if d.given {
+		c, err := detect.NewWithChanges(d.paths, gitChanges(d.changes), d.opt)
+		if err != nil {
+			return nil, err
+		}
+		explanations, err := c.Explain(ctx)
+		if err != nil {
+			return nil, publicError(err)
+		}
+		return newExplanations(explanations), nil
+	}
+
+	c, err := detect.New(ctx, d.path, d.paths, d.opt)
+	if err != nil {
+		return nil, publicError(err)
+	}
+	explanations, err := c.Explain(ctx)
+	if err != nil {
+		return nil, publicError(err)
+	}
+	return newExplanations(explanations), nil
+}
+
+// ParseChanges reads changes from the output of `git diff --name-status`
+// (with or without -z), a plain path list or a JSON array of
+// {"path":...,"type":...} objects.
+func ParseChanges(r io.Reader) ([]Change, error) {
+	changes, err := git.ParseChanges(r)
+	if err != nil {
+		return []Change{}, err
+	}
+	return publicChanges(changes), nil
+}
+
+// ParseChangeType converts a type name such as "added" into ChangeType.
+func ParseChangeType(s string) (ChangeType, error) {
+	ty, err := git.ParseType(s)
+	return ChangeType(ty), err
+}
@@ -0,0 +1,125 @@
+package changedobjects_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+// newRepo creates a repository on the main branch whose last commit adds
+// files.
+func newRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := wt.AddGlob("."); err != nil {
+			t.Fatal(err)
+		}
+		_, err := wt.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(map[string]string{"README.md": "readme"})
+	commit(files)
+	return dir
+}
+
+func TestRun_rootMarkerOutsideRepo(t *testing.T) {
+	repo := newRepo(t, map[string]string{
+		"terraform/a/main.tf":        "",
+		"terraform/a/modules/x.json": "{}",
+		"terraform/b/main.tf":        "",
+	})
+	// the current directory is outside the repository
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, ceiling := range []string{"", repo, "terraform"} {
+		d, err := changedobjects.New(repo,
+			changedobjects.WithRootMarker("*.tf"),
+			changedobjects.WithRootMarkerCeiling(ceiling),
+			changedobjects.WithExistFrom(changedobjects.ExistFromHead),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff, err := d.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, dir := range diff.Dirs {
+			got = append(got, dir.Path)
+		}
+		if diff := cmp.Diff(got, []string{"terraform/a", "terraform/b"}); diff != "" {
+			t.Errorf("ceiling %q: Result is mismatch (-got +want):\n%s", ceiling, diff)
+		}
+	}
+}
+
+func TestNew_rootMarkerCeilingOutsideRepo(t *testing.T) {
+	repo := newRepo(t, map[string]string{"terraform/a/main.tf": ""})
+
+	cases := []struct {
+		name    string
+		ceiling string
+		wantErr bool
+	}{
+		{name: "root", ceiling: repo},
+		{name: "relative dir in the repository", ceiling: "terraform"},
+		{name: "dir in the repository", ceiling: filepath.Join(repo, "terraform")},
+		{name: "parent of the repository", ceiling: filepath.Dir(repo), wantErr: true},
+		{name: "other dir", ceiling: "/", wantErr: true},
+		{name: "relative dir above the repository", ceiling: "../", wantErr: true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := changedobjects.New(repo,
+				changedobjects.WithRootMarker("*.tf"),
+				changedobjects.WithRootMarkerCeiling(tt.ceiling),
+			)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package changedobjects detects files and directories changed between two
+// points of a git history and groups them the same way the changed-objects
+// command does.
+//
+// The command line tool is a thin wrapper around this package:
+//
+//	d, err := changedobjects.New(".",
+//		changedobjects.WithDefaultBranch("main"),
+//		changedobjects.WithGroupBy("terraform/*/*"),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	diff, err := d.Run(ctx)
+//
+// # Logging
+//
+// Run, Walk and Explain write diagnostics to the standard logger of the log
+// package, as lines prefixed with a level such as "[DEBUG]" or "[TRACE]".
+// The command filters them by level with the LOG environment variable.
+// Programs which do not want them on stderr should silence or filter the
+// standard logger, e.g. with log.SetOutput(io.Discard).
+//
+// # Compatibility
+//
+// The exported identifiers of this package are not removed or changed
+// incompatibly in patch releases. While the module is v0, an incompatible
+// change may only happen in a minor release and is called out in the
+// CHANGELOG; from v1 on, only in a major release. New options and new fields
+// on Diff, Dir and File may be added at any time, so do not rely on the
+// positional layout of these structs. The JSON encoding of Diff is part of
+// this promise as it is the output format of the command.
+//
+// Everything under internal/ is not covered and may change at any time.
+package changedobjects
@@ -0,0 +1,64 @@
+package changedobjects_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+func Example() {
+	d, err := changedobjects.New(".",
+		changedobjects.WithDefaultBranch("main"),
+		changedobjects.WithGroupBy("terraform/*/*"),
+		changedobjects.WithTypes(changedobjects.Addition, changedobjects.Modification),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diff, err := d.Run(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, dir := range diff.Dirs {
+		fmt.Println(dir.Path)
+	}
+}
+
+func ExampleWithChanges() {
+	changes, err := changedobjects.ParseChanges(strings.NewReader(
+		"M\tterraform/service-a/prod/main.tf\n" +
+			"A\tterraform/service-a/prod/modules/vpc/main.tf\n" +
+			"M\tREADME.md\n",
+	))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d, err := changedobjects.New(".",
+		changedobjects.WithChanges(changes),
+		changedobjects.WithPaths("terraform"),
+		changedobjects.WithGroupBy("terraform/*/*"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diff, err := d.Run(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, dir := range diff.Dirs {
+		fmt.Printf("%s: %d files\n", dir.Path, len(dir.Files))
+		for _, file := range dir.Files {
+			fmt.Printf("  %s (%s)\n", file.Path, file.Type)
+		}
+	}
+	// Output:
+	// terraform/service-a/prod: 2 files
+	//   terraform/service-a/prod/main.tf (modified)
+	//   terraform/service-a/prod/modules/vpc/main.tf (added)
+}
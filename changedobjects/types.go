@@ -0,0 +1,271 @@
+package changedobjects
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/babarot/changed-objects/internal/detect"
+	"github.com/babarot/changed-objects/internal/git"
+)
+
+// Diff is the result of Run: the changed files and the directories they are
+// grouped into.
+type Diff struct {
+	// Files are the changed files left after filtering.
+	Files []File `json:"files"`
+	// Dirs are the directories Files are grouped into.
+	Dirs []Dir `json:"dirs"`
+}
+
+// File is a changed file.
+type File struct {
+	// Name is the base name of the file.
+	Name string `json:"name"`
+	// Path is the path of the file relative to the repository root.
+	Path string `json:"path"`
+	// Type is how the file changed.
+	Type ChangeType `json:"type"`
+	// ParentDir is the directory the file lives in.
+	ParentDir ParentDir `json:"parent_dir"`
+}
+
+// ParentDir is the directory a File lives in.
+type ParentDir struct {
+	// Path is the path of the directory relative to the repository root.
+	Path string `json:"path"`
+	// Exist reports whether the directory exists, in the working tree or
+	// in the tree chosen with WithExistFrom.
+	Exist bool `json:"exist"`
+	// ExistInBase reports whether the directory exists in the base commit.
+	// It is nil if the base commit is not known, e.g. with WithChanges.
+	ExistInBase *bool `json:"exist_in_base,omitempty"`
+}
+
+// Dir is a group of changed files.
+type Dir struct {
+	// Path is the path of the directory relative to the repository root.
+	Path string `json:"path"`
+	// Exist reports whether the directory exists, in the working tree or
+	// in the tree chosen with WithExistFrom.
+	Exist bool `json:"exist"`
+	// ExistInBase reports whether the directory exists in the base commit.
+	// It is nil if the base commit is not known, e.g. with WithChanges.
+	ExistInBase *bool `json:"exist_in_base,omitempty"`
+	// Files are the changed files grouped into the directory.
+	Files []File `json:"files"`
+	// Pattern is the group-by pattern the directory was grouped by, if
+	// any.
+	Pattern string `json:"pattern,omitempty"`
+	// Labels are the values of the named placeholders of Pattern, e.g.
+	// {"service": "a"} for terraform/{service}/*.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Marker is the root marker found in the directory, if it was resolved
+	// by one.
+	Marker string `json:"marker,omitempty"`
+	// ResolvedFrom is ResolvedFromBase if the marker was found in the base
+	// commit instead of the working tree, e.g. for a deleted directory.
+	ResolvedFrom string `json:"resolved_from,omitempty"`
+	// Shard is the shard the directory is assigned to with WithShards.
+	Shard *int `json:"shard,omitempty"`
+}
+
+// Entry is a File or a Dir passed to the callback of Walk. Either File or
+// Dir is set.
+type Entry struct {
+	File *File `json:"file,omitempty"`
+	Dir  *Dir  `json:"dir,omitempty"`
+}
+
+// Explanation lists why a changed file was included, excluded or grouped
+// into a Dir.
+type Explanation struct {
+	// Path is the path of the changed file.
+	Path string `json:"path"`
+	// Type is how the file changed.
+	Type ChangeType `json:"type"`
+	// Included reports whether the file passed all the filters and is
+	// listed in Diff.Files.
+	Included bool `json:"included"`
+	// Dir is the path of the Dir the file is grouped into, if any.
+	Dir string `json:"dir"`
+	// Decisions are the steps taken for the file, in order.
+	Decisions []Decision `json:"decisions"`
+}
+
+// Decision is a step of an Explanation.
+type Decision struct {
+	// Stage is the filter or the grouping step, e.g. "ignore" or
+	// "root-marker".
+	Stage string `json:"stage"`
+	// Result is what the stage did, e.g. "kept" or "dropped".
+	Result string `json:"result"`
+	// Reason describes why, e.g. the rule that matched.
+	Reason string `json:"reason"`
+}
+
+// Change is a changed path as reported by git.
+type Change struct {
+	// Path is the path relative to the repository root.
+	Path string
+	// Type is how the path changed.
+	Type ChangeType
+}
+
+// ChangeType is the kind of a Change. It is encoded in JSON as "added",
+// "deleted", "modified" or "unknown".
+type ChangeType int
+
+const (
+	Addition     = ChangeType(git.Addition)
+	Deletion     = ChangeType(git.Deletion)
+	Modification = ChangeType(git.Modification)
+	Unknown      = ChangeType(git.Unknown)
+)
+
+func (t ChangeType) String() string {
+	return git.Type(t).String()
+}
+
+func (t ChangeType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *ChangeType) UnmarshalJSON(data []byte) error {
+	var ty git.Type
+	if err := ty.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*t = ChangeType(ty)
+	return nil
+}
+
+// PhaseError is returned by Run when ctx is canceled or its deadline is
+// exceeded.
+type PhaseError struct {
+	// Phase names the step that was running, e.g. "computing merge-base".
+	Phase string
+	// Err is the error of ctx.
+	Err error
+}
+
+func (e *PhaseError) Error() string {
+	return (&git.PhaseError{Phase: e.Phase, Err: e.Err}).Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// publicError converts the internal PhaseError into a PhaseError.
+func publicError(err error) error {
+	var pe *git.PhaseError
+	if errors.As(err, &pe) {
+		return &PhaseError{Phase: pe.Phase, Err: pe.Err}
+	}
+	return err
+}
+
+// The conversions below keep nil slices nil so that the JSON encoding is the
+// same as the one of the internal types.
+
+func newDiff(d detect.Diff) Diff {
+	diff := Diff{Files: newFiles(d.Files)}
+	if d.Dirs != nil {
+		diff.Dirs = make([]Dir, 0, len(d.Dirs))
+		for _, dir := range d.Dirs {
+			diff.Dirs = append(diff.Dirs, newDir(dir))
+		}
+	}
+	return diff
+}
+
+func newFiles(fs []detect.File) []File {
+	if fs == nil {
+		return nil
+	}
+	files := make([]File, 0, len(fs))
+	for _, f := range fs {
+		files = append(files, newFile(f))
+	}
+	return files
+}
+
+func newFile(f detect.File) File {
+	return File{
+		Name: f.Name,
+		Path: f.Path,
+		Type: ChangeType(f.Type),
+		ParentDir: ParentDir{
+			Path:        f.ParentDir.Path,
+			Exist:       f.ParentDir.Exist,
+			ExistInBase: f.ParentDir.ExistInBase,
+		},
+	}
+}
+
+func newDir(d detect.Dir) Dir {
+	return Dir{
+		Path:         d.Path,
+		Exist:        d.Exist,
+		ExistInBase:  d.ExistInBase,
+		Files:        newFiles(d.Files),
+		Pattern:      d.Pattern,
+		Labels:       d.Labels,
+		Marker:       d.Marker,
+		ResolvedFrom: d.ResolvedFrom,
+		Shard:        d.Shard,
+	}
+}
+
+func newEntry(e detect.Entry) Entry {
+	var entry Entry
+	if e.File != nil {
+		f := newFile(*e.File)
+		entry.File = &f
+	}
+	if e.Dir != nil {
+		d := newDir(*e.Dir)
+		entry.Dir = &d
+	}
+	return entry
+}
+
+func newExplanations(es []detect.Explanation) []Explanation {
+	if es == nil {
+		return nil
+	}
+	explanations := make([]Explanation, 0, len(es))
+	for _, e := range es {
+		var decisions []Decision
+		if e.Decisions != nil {
+			decisions = make([]Decision, 0, len(e.Decisions))
+		}
+		for _, d := range e.Decisions {
+			decisions = append(decisions, Decision{Stage: d.Stage, Result: d.Result, Reason: d.Reason})
+		}
+		explanations = append(explanations, Explanation{
+			Path:      e.Path,
+			Type:      ChangeType(e.Type),
+			Included:  e.Included,
+			Dir:       e.Dir,
+			Decisions: decisions,
+		})
+	}
+	return explanations
+}
+
+func gitChanges(changes []Change) []git.Change {
+	cs := make([]git.Change, 0, len(changes))
+	for _, c := range changes {
+		cs = append(cs, git.Change{Path: c.Path, Type: git.Type(c.Type)})
+	}
+	return cs
+}
+
+func publicChanges(changes []git.Change) []Change {
+	cs := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		cs = append(cs, Change{Path: c.Path, Type: ChangeType(c.Type)})
+	}
+	return cs
+}
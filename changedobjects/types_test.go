@@ -0,0 +1,101 @@
+package changedobjects
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/babarot/changed-objects/internal/detect"
+	"github.com/babarot/changed-objects/internal/git"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTypes_json(t *testing.T) {
+	t.Parallel()
+
+	exist, shard := false, 1
+	file := detect.File{
+		Name:      "main.tf",
+		Path:      "terraform/a/main.tf",
+		Type:      git.Deletion,
+		ParentDir: detect.ParentDir{Path: "terraform/a", Exist: true, ExistInBase: &exist},
+	}
+	dir := detect.Dir{
+		Path:         "terraform/a",
+		Exist:        true,
+		ExistInBase:  &exist,
+		Files:        []detect.File{file},
+		Pattern:      "terraform/{service}",
+		Labels:       map[string]string{"service": "a"},
+		Marker:       "main.tf",
+		ResolvedFrom: detect.ResolvedFromBase,
+		Shard:        &shard,
+	}
+	explanation := detect.Explanation{
+		Path:      file.Path,
+		Type:      git.Modification,
+		Included:  true,
+		Dir:       dir.Path,
+		Decisions: []detect.Decision{{Stage: "ignore", Result: "kept", Reason: "no rule matched"}},
+	}
+
+	tests := map[string]struct {
+		internal any
+		public   any
+	}{
+		"diff": {
+			internal: detect.Diff{Files: []detect.File{file}, Dirs: []detect.Dir{dir}},
+			public:   newDiff(detect.Diff{Files: []detect.File{file}, Dirs: []detect.Dir{dir}}),
+		},
+		"empty diff": {
+			internal: detect.Diff{},
+			public:   newDiff(detect.Diff{}),
+		},
+		"file entry": {
+			internal: detect.Entry{File: &file},
+			public:   newEntry(detect.Entry{File: &file}),
+		},
+		"dir entry": {
+			internal: detect.Entry{Dir: &dir},
+			public:   newEntry(detect.Entry{Dir: &dir}),
+		},
+		"explanations": {
+			internal: []detect.Explanation{explanation, {Path: "x", Type: git.Unknown}},
+			public:   newExplanations([]detect.Explanation{explanation, {Path: "x", Type: git.Unknown}}),
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			want, err := json.Marshal(tt.internal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(tt.public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(got), string(want)); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChangeType_json(t *testing.T) {
+	t.Parallel()
+
+	for _, ty := range []ChangeType{Addition, Deletion, Modification} {
+		b, err := json.Marshal(ty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ChangeType
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, ty); diff != "" {
+			t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+		}
+	}
+}
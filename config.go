@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/babarot/changed-objects/internal/config"
+	"github.com/babarot/changed-objects/internal/detect"
+	"github.com/jessevdk/go-flags"
+)
+
+type configCommand struct {
+	Validate struct{} `command:"validate" description:"Report unknown keys and bad glob patterns in the configuration file"`
+}
+
+// globOptions are the options taking glob patterns, which are validated
+// when reading the configuration file.
+var globOptions = map[string]bool{
+	"include":  true,
+	"ignore":   true,
+	"group-by": true,
+}
+
+// cliOnlyOptions are the options which cannot be set in the configuration
+// file.
+var cliOnlyOptions = map[string]bool{
+	"version": true,
+	"help":    true,
+	"config":  true,
+	"profile": true,
+}
+
+func loadConfig(repo, path string) (*config.Config, error) {
+	if path == "" {
+		path = config.Find(repo)
+		if path == "" {
+			log.Printf("[DEBUG] no configuration file found in %s", repo)
+			return nil, nil
+		}
+	}
+	log.Printf("[INFO] configuration file: %s", path)
+	return config.Load(path)
+}
+
+// knownOption reports whether the configuration file can set the option
+// named key.
+func knownOption(key string) bool {
+	if cliOnlyOptions[key] {
+		return false
+	}
+	var opt Option
+	return newParser(&opt).FindOptionByLongName(key) != nil
+}
+
+// checkOptionValue reports a malformed glob pattern given to one of
+// globOptions, or a malformed root marker or shard weight.
+func checkOptionValue(key, value string) error {
+	switch {
+	case globOptions[key]:
+		return detect.ValidatePattern(value)
+	case key == "root-marker":
+		return detect.ValidateRootMarker(value)
+	case key == "shard-weight":
+		return detect.ValidateShardWeight(value)
+	}
+	return nil
+}
+
+// configArgs converts the settings in cfg into command line arguments,
+// skipping the options already given on the command line.
+func configArgs(p *flags.Parser, cfg *config.Config, profile string) ([]string, error) {
+	settings, err := cfg.Settings(profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateProfile(profile, knownOption, checkOptionValue); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, setting := range settings {
+		option := p.FindOptionByLongName(setting.Key)
+		// options with a default tag are set too, even if not given
+		if option.IsSet() && !option.IsSetDefault() {
+			log.Printf("[DEBUG] %s: %s is overridden by the command line", cfg.Path, setting.Key)
+			continue
+		}
+		if option.Field().Type.Kind() == reflect.Bool {
+			for _, value := range setting.Values {
+				switch value {
+				case "true":
+					args = append(args, "--"+setting.Key)
+				case "false":
+				default:
+					return nil, fmt.Errorf("%s:%d: %s: expected true or false, got %q", cfg.Path, setting.Line, setting.Key, value)
+				}
+			}
+			continue
+		}
+		for _, value := range setting.Values {
+			args = append(args, fmt.Sprintf("--%s=%s", setting.Key, value))
+		}
+	}
+	return args, nil
+}
+
+// validateConfig checks the keys, the glob patterns and the values of
+// every profile in cfg.
+func validateConfig(cfg *config.Config) error {
+	if cfg == nil {
+		return fmt.Errorf("no configuration file found (looked for %v)", config.FileNames)
+	}
+
+	if err := cfg.Validate(knownOption, checkOptionValue); err != nil {
+		return err
+	}
+
+	for _, profile := range append([]string{""}, cfg.ProfileNames()...) {
+		var opt Option
+		p := newParser(&opt)
+		args, err := configArgs(p, cfg, profile)
+		if err != nil {
+			return err
+		}
+		if _, err := newParser(&opt).ParseArgs(args); err != nil {
+			if profile != "" {
+				return fmt.Errorf("%s: profile %q: %w", cfg.Path, profile, err)
+			}
+			return fmt.Errorf("%s: %w", cfg.Path, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: ok\n", cfg.Path)
+	return nil
+}
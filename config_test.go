@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babarot/changed-objects/internal/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_configArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".changed-objects.yaml")
+	data := `default-branch: develop
+output: lines
+sort: size
+group-by: terraform/*/*
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		want Option
+	}{
+		{
+			name: "defaulted options are set from the config",
+			want: Option{DefaultBranch: "develop", Output: "lines", Sort: "size", GroupBy: []string{"terraform/*/*"}},
+		},
+		{
+			name: "flags given on the command line win",
+			args: []string{"--sort", "path", "--group-by", "k8s/*"},
+			want: Option{DefaultBranch: "develop", Output: "lines", Sort: "path", GroupBy: []string{"k8s/*"}},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var opt Option
+			p := newParser(&opt)
+			if _, err := p.ParseArgs(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			args, err := configArgs(p, cfg, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opt = Option{}
+			if _, err := newParser(&opt).ParseArgs(append(args, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			got := Option{DefaultBranch: opt.DefaultBranch, Output: opt.Output, Sort: opt.Sort, GroupBy: opt.GroupBy}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the names of the configuration file looked up in the
+// repository root, in order of precedence.
+var FileNames = []string{".changed-objects.yaml", ".changed-objects.yml"}
+
+// Setting is a value of an option given in the configuration file. Key is
+// the long name of the command line flag.
+type Setting struct {
+	Key    string
+	Values []string
+	Line   int
+}
+
+type Config struct {
+	Path     string
+	Defaults []Setting
+	Profiles map[string][]Setting
+}
+
+// Find returns the path of the configuration file in dir, or an empty
+// string if there is none.
+func Find(dir string) string {
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg := &Config{
+		Path:     path,
+		Profiles: map[string][]Setting{},
+	}
+	if len(doc.Content) == 0 {
+		// empty file
+		return cfg, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: top level must be a mapping", path, root.Line)
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "profiles" {
+			setting, err := parseSetting(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%w", path, err)
+			}
+			cfg.Defaults = append(cfg.Defaults, setting)
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: profiles must be a mapping", path, value.Line)
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			name, body := value.Content[j], value.Content[j+1]
+			if body.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s:%d: profile %q must be a mapping", path, body.Line, name.Value)
+			}
+			settings := []Setting{}
+			for k := 0; k < len(body.Content); k += 2 {
+				setting, err := parseSetting(body.Content[k], body.Content[k+1])
+				if err != nil {
+					return nil, fmt.Errorf("%s:%w", path, err)
+				}
+				settings = append(settings, setting)
+			}
+			cfg.Profiles[name.Value] = settings
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseSetting(key, value *yaml.Node) (Setting, error) {
+	setting := Setting{Key: key.Value, Values: []string{}, Line: key.Line}
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if value.Tag != "!!null" {
+			setting.Values = append(setting.Values, value.Value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return Setting{}, fmt.Errorf("%d: %s: list items must be scalars", item.Line, key.Value)
+			}
+			setting.Values = append(setting.Values, item.Value)
+		}
+	default:
+		return Setting{}, fmt.Errorf("%d: %s: value must be a scalar or a list", value.Line, key.Value)
+	}
+	return setting, nil
+}
+
+// ProfileNames returns the names of the defined profiles in sorted order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Settings returns the top level settings overridden by the ones of the
+// given profile. An empty profile returns the top level settings only.
+func (c *Config) Settings(profile string) ([]Setting, error) {
+	if profile == "" {
+		return c.Defaults, nil
+	}
+
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%s: profile %q is not defined (available: %v)", c.Path, profile, c.ProfileNames())
+	}
+
+	overridden := map[string]bool{}
+	for _, setting := range overrides {
+		overridden[setting.Key] = true
+	}
+
+	var settings []Setting
+	for _, setting := range c.Defaults {
+		if !overridden[setting.Key] {
+			settings = append(settings, setting)
+		}
+	}
+	return append(settings, overrides...), nil
+}
+
+// Validate reports unknown keys and malformed values in the top level
+// settings and in every profile. known reports whether a key is a valid
+// option, checkValue returns an error for a malformed value of it, e.g. a
+// bad glob pattern.
+func (c *Config) Validate(known func(key string) bool, checkValue func(key, value string) error) error {
+	errs := c.check("", c.Defaults, known, checkValue)
+	for _, name := range c.ProfileNames() {
+		errs = append(errs, c.check(name, c.Profiles[name], known, checkValue)...)
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateProfile is like Validate but only checks the top level settings
+// and the given profile.
+func (c *Config) ValidateProfile(profile string, known func(key string) bool, checkValue func(key, value string) error) error {
+	errs := c.check("", c.Defaults, known, checkValue)
+	if profile != "" {
+		errs = append(errs, c.check(profile, c.Profiles[profile], known, checkValue)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) check(profile string, settings []Setting, known func(key string) bool, checkValue func(key, value string) error) []error {
+	where := ""
+	if profile != "" {
+		where = fmt.Sprintf("profile %q: ", profile)
+	}
+
+	var errs []error
+	for _, setting := range settings {
+		if !known(setting.Key) {
+			errs = append(errs, fmt.Errorf("%s:%d: %sunknown key %q", c.Path, setting.Line, where, setting.Key))
+			continue
+		}
+		for _, value := range setting.Values {
+			if err := checkValue(setting.Key, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %s%s: %w", c.Path, setting.Line, where, setting.Key, err))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testConfig = `
+group-by:
+  - terraform/*/*
+type: [added, modified]
+root-marker: "*.tf"
+profiles:
+  k8s:
+    group-by: kubernetes/**/overlays/*
+    root-marker:
+  broken:
+    gruop-by: x
+    ignore: "[oops"
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileNames[0])
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSettings(t *testing.T) {
+	cfg, err := Load(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		profile string
+		want    []Setting
+	}{
+		{
+			name:    "top level only",
+			profile: "",
+			want: []Setting{
+				{Key: "group-by", Values: []string{"terraform/*/*"}, Line: 2},
+				{Key: "type", Values: []string{"added", "modified"}, Line: 4},
+				{Key: "root-marker", Values: []string{"*.tf"}, Line: 5},
+			},
+		},
+		{
+			name:    "profile overrides top level",
+			profile: "k8s",
+			want: []Setting{
+				{Key: "type", Values: []string{"added", "modified"}, Line: 4},
+				{Key: "group-by", Values: []string{"kubernetes/**/overlays/*"}, Line: 8},
+				{Key: "root-marker", Values: []string{}, Line: 9},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.Settings(tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := cfg.Settings("undefined"); err == nil {
+		t.Error("Settings should fail for an undefined profile")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := func(key string) bool {
+		return key != "gruop-by"
+	}
+	checkValue := func(key, value string) error {
+		if key == "ignore" && value == "[oops" {
+			return fmt.Errorf("bad glob pattern %q", value)
+		}
+		return nil
+	}
+
+	if err := cfg.ValidateProfile("k8s", known, checkValue); err != nil {
+		t.Errorf("ValidateProfile(k8s) should succeed, got %v", err)
+	}
+
+	err = cfg.Validate(known, checkValue)
+	if err == nil {
+		t.Fatal("Validate should fail")
+	}
+	for _, want := range []string{`:11: profile "broken": unknown key "gruop-by"`, `:12: profile "broken": ignore: bad glob pattern "[oops"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package detect
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/babarot/changed-objects/internal/git"
+)
+
+const (
+	CollapseNone       = "none"
+	CollapseAncestor   = "ancestor"
+	CollapseDescendant = "descendant"
+)
+
+func validateCollapse(mode string) error {
+	switch mode {
+	case "", CollapseNone, CollapseAncestor, CollapseDescendant:
+		return nil
+	}
+	return fmt.Errorf("invalid collapse mode: %q (expected %s, %s or %s)", mode, CollapseNone, CollapseAncestor, CollapseDescendant)
+}
+
+// collapseDirs handles dirs nested in other dirs. CollapseAncestor merges the
+// files of a nested dir into its topmost ancestor, CollapseDescendant drops
+// the dirs having a nested dir so that only the leaves are left. The root
+// dir "." is not considered an ancestor of the others.
+func collapseDirs(dirs []Dir, mode string, rec *recorder) []Dir {
+	if mode == "" || mode == CollapseNone {
+		return dirs
+	}
+
+	sorted := append([]Dir(nil), dirs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	reported := make(map[string]bool, len(sorted))
+	for _, dir := range sorted {
+		reported[dir.Path] = true
+	}
+
+	var collapsed []Dir
+	switch mode {
+	case CollapseAncestor:
+		index := make(map[string]int)
+		for _, dir := range sorted {
+			top := ""
+			// steps go from the dir up to the root, so the last one
+			// reported is the topmost ancestor
+			for _, step := range getSteps(dir.Path)[1:] {
+				if reported[step] {
+					top = step
+				}
+			}
+			if top == "" {
+				index[dir.Path] = len(collapsed)
+				collapsed = append(collapsed, dir)
+				continue
+			}
+			i := index[top]
+			files := collapsed[i].Files
+			collapsed[i].Files = append(files[:len(files):len(files)], dir.Files...)
+			for _, file := range dir.Files {
+				change := git.Change{Path: file.Path, Type: file.Type}
+				rec.add(change, "collapse", resultGrouped, "%q is nested in %q", dir.Path, top)
+				rec.group(change, top)
+			}
+		}
+	case CollapseDescendant:
+		nested := make(map[string]string)
+		for _, dir := range sorted {
+			for _, step := range getSteps(dir.Path)[1:] {
+				if reported[step] {
+					nested[step] = dir.Path
+				}
+			}
+		}
+		for _, dir := range sorted {
+			child, ok := nested[dir.Path]
+			if !ok {
+				collapsed = append(collapsed, dir)
+				continue
+			}
+			for _, file := range dir.Files {
+				change := git.Change{Path: file.Path, Type: file.Type}
+				rec.add(change, "collapse", resultDropped, "%q has a nested dir %q", dir.Path, child)
+				rec.group(change, "")
+			}
+		}
+	}
+	return collapsed
+}
@@ -1,9 +1,11 @@
 package detect
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/babarot/changed-objects/internal/git"
@@ -13,24 +15,57 @@ import (
 )
 
 type client struct {
-	args    []string
-	opt     Option
-	changes []git.Change
-	pp      *pp.PrettyPrinter
+	args     []string
+	opt      Option
+	changes  []git.Change
+	ignores  []rule
+	includes []include
+	grouping grouping
+	sharding sharding
+	markers  []rootMarker
+	// base is the tree of the base commit, if known, where root markers
+	// of deleted dirs are looked up
+	base fileSystem
+	// exist is where the existence of dirs is checked
+	exist fileSystem
+	rec   *recorder
+	pp    *pp.PrettyPrinter
 }
 
 type Option struct {
 	DefaultBranch string
 	MergeBase     string
 	Types         []string
+	Includes      []string
 	Ignores       []string
+	IgnoreFile    string
 	GroupBy       []string
+	GroupByMatch  string
+	Depth         int
+	DepthFrom     string
+	Collapse      string
 	DirExist      string
-	RootMarker    string
+	RootMarkers   []string
+	// RootMarkerCeiling is the directory above which root markers are not
+	// looked up, relative to the repository root, which is the default.
+	RootMarkerCeiling  string
+	RootMarkerMaxDepth int
+	// ExistFrom is where the existence of dirs is checked, the working
+	// tree by default.
+	ExistFrom string
+	// Sort is the key files and dirs are ordered by, their path by
+	// default.
+	Sort    string
+	Reverse bool
+	// Shards is the number of shards dirs are partitioned into, or 0 not
+	// to shard them. ShardIndex keeps only the dirs of one shard.
+	Shards       int
+	ShardIndex   *int
+	ShardWeights []string
 }
 
-func New(path string, args []string, opt Option) (client, error) {
-	changes, err := git.Open(git.Config{
+func New(ctx context.Context, path string, args []string, opt Option) (client, error) {
+	comparison, err := git.Open(ctx, git.Config{
 		Path:          path,
 		DefaultBranch: opt.DefaultBranch,
 		MergeBase:     opt.MergeBase,
@@ -38,124 +73,342 @@ func New(path string, args []string, opt Option) (client, error) {
 	if err != nil {
 		return client{}, err
 	}
+	c, err := newClient(args, comparison.Changes, opt)
+	if err != nil {
+		return client{}, err
+	}
+	c.base = comparison.Base
+	if opt.ExistFrom == ExistFromHead {
+		c.exist = comparison.Target
+	}
+	return c, nil
+}
+
+// NewWithChanges returns a client working on the given changes instead of
+// the ones computed from a git repository.
+func NewWithChanges(args []string, changes []git.Change, opt Option) (client, error) {
+	c, err := newClient(args, changes, opt)
+	if err != nil {
+		return client{}, err
+	}
+	if c.exist == nil {
+		return client{}, fmt.Errorf("exist-from %q needs git commits, which are not compared when changes are given", opt.ExistFrom)
+	}
+	return c, nil
+}
+
+func newClient(args []string, changes []git.Change, opt Option) (client, error) {
+	var exist fileSystem
+	switch opt.ExistFrom {
+	case "", ExistFromWorktree:
+		exist = osFS{}
+	case ExistFromHead:
+		// set by New
+	default:
+		return client{}, fmt.Errorf("invalid exist-from source: %q (expected %s or %s)", opt.ExistFrom, ExistFromWorktree, ExistFromHead)
+	}
+
+	var includes []include
+	for _, text := range opt.Includes {
+		include, err := newInclude(text)
+		if err != nil {
+			return client{}, err
+		}
+		includes = append(includes, include)
+	}
+
+	grouping, err := newGrouping(opt.GroupBy, opt.GroupByMatch)
+	if err != nil {
+		return client{}, err
+	}
+	if err := grouping.setDepth(opt.Depth, opt.DepthFrom); err != nil {
+		return client{}, err
+	}
+	if err := validateCollapse(opt.Collapse); err != nil {
+		return client{}, err
+	}
+	if err := validateSort(opt.Sort); err != nil {
+		return client{}, err
+	}
+	sharding, err := newSharding(opt.Shards, opt.ShardIndex, opt.ShardWeights)
+	if err != nil {
+		return client{}, err
+	}
+
+	if opt.RootMarkerMaxDepth < 0 {
+		return client{}, fmt.Errorf("invalid root-marker max depth: %d", opt.RootMarkerMaxDepth)
+	}
+	if err := ValidateRootMarkerCeiling(opt.RootMarkerCeiling); err != nil {
+		return client{}, err
+	}
+	var markers []rootMarker
+	for _, text := range opt.RootMarkers {
+		marker, err := newRootMarker(text)
+		if err != nil {
+			return client{}, err
+		}
+		markers = append(markers, marker)
+	}
+
+	var ignores []rule
+	if opt.IgnoreFile != "" {
+		rules, err := readIgnoreFile(opt.IgnoreFile)
+		if err != nil {
+			return client{}, err
+		}
+		ignores = append(ignores, rules...)
+	}
+	// --ignore flags are evaluated after the ignore file so they win
+	for _, ignore := range opt.Ignores {
+		r, err := newRule(ignore, "--ignore")
+		if err != nil {
+			return client{}, err
+		}
+		ignores = append(ignores, r)
+	}
 
 	printer := pp.New()
 	printer.SetColoringEnabled(false)
 	printer.SetExportedOnly(true)
 	return client{
-		args:    args,
-		opt:     opt,
-		changes: changes,
-		pp:      printer,
+		args:     args,
+		opt:      opt,
+		changes:  changes,
+		ignores:  ignores,
+		includes: includes,
+		grouping: grouping,
+		sharding: sharding,
+		markers:  markers,
+		exist:    exist,
+		pp:       printer,
 	}, nil
 }
 
-func (c client) Run() (Diff, error) {
-	changes := c.changes
+// Walk runs the detection like Run, but calls fn with each file and then
+// each dir instead of returning a Diff. The files and the dirs are still
+// computed in full first, as sorting and sharding need all of them; Walk
+// only spares the caller its own copy of the result. Files are passed
+// before the dirs are grouped unless a shard is selected. Walk stops at the
+// first error returned by fn.
+func (c client) Walk(ctx context.Context, fn func(Entry) error) error {
+	// the same change may be given twice, e.g. by --changes-from
+	changes := lo.Uniq(c.changes)
 
-	for _, arg := range c.args {
-		// filter by given dir names
-		changes = lo.Filter(changes, func(change git.Change, _ int) bool {
-			return strings.Index(filepath.Dir(change.Path), arg) == 0
-		})
+	if err := ctx.Err(); err != nil {
+		return git.InPhase(ctx, "filtering changes", err)
 	}
 
-	for _, ignore := range c.opt.Ignores {
-		// filter out by given patterns
-		changes = lo.Filter(changes, func(change git.Change, _ int) bool {
-			match, err := doublestar.Match(ignore, filepath.Dir(change.Path))
-			if err != nil {
-				return false
-			}
-			return !match
-		})
-	}
-
-	if len(c.opt.Types) > 0 {
-		// filter by change type
-		filtered := []git.Change{}
-		for _, ty := range c.opt.Types {
-			filtered = append(filtered, lo.Filter(changes, func(change git.Change, _ int) bool {
-				switch ty {
-				case "added":
-					return change.Type == git.Addition
-				case "deleted":
-					return change.Type == git.Deletion
-				case "modified":
-					return change.Type == git.Modification
-				}
-				return false
-			})...)
+	// filter by given paths
+	changes = lo.Filter(changes, func(change git.Change, _ int) bool {
+		if len(c.args) == 0 {
+			c.rec.filter(change, "args", true, "no paths are given")
+			return true
 		}
-		changes = filtered
-	}
+		ok := matchArgs(c.args, change.Path)
+		c.rec.filter(change, "args", ok, "under one of %q: %v", c.args, ok)
+		return ok
+	})
+
+	// filter by include patterns
+	changes = lo.Filter(changes, func(change git.Change, _ int) bool {
+		if len(c.includes) == 0 {
+			c.rec.filter(change, "include", true, "no include patterns are given")
+			return true
+		}
+		if include, ok := matchIncludes(c.includes, change); ok {
+			log.Printf("[TRACE] Run: %q (%s) is included by %q", change.Path, change.Type, include.text)
+			c.rec.filter(change, "include", true, "matched include pattern %q", include.text)
+			return true
+		}
+		log.Printf("[DEBUG] Run: %q (%s) is excluded: no include pattern matched", change.Path, change.Type)
+		c.rec.filter(change, "include", false, "no include pattern matched")
+		return false
+	})
+
+	// filter out by ignore rules, which win over include patterns
+	changes = lo.Filter(changes, func(change git.Change, _ int) bool {
+		r, ignored := matchRules(c.ignores, change)
+		switch {
+		case ignored:
+			log.Printf("[DEBUG] Run: %q (%s) is excluded: ignored by %s", change.Path, change.Type, r)
+			c.rec.filter(change, "ignore", false, "ignored by %s", r)
+		case r.text != "":
+			c.rec.filter(change, "ignore", true, "re-included by %s", r)
+		default:
+			c.rec.filter(change, "ignore", true, "no ignore rule matched")
+		}
+		return !ignored
+	})
+
+	// filter by change type, keeping the order of the changes
+	changes = lo.Filter(changes, func(change git.Change, _ int) bool {
+		if len(c.opt.Types) == 0 {
+			c.rec.filter(change, "type", true, "no types are given")
+			return true
+		}
+		ok := lo.Contains(c.opt.Types, change.Type.String())
+		c.rec.filter(change, "type", ok, "%s is one of %q: %v", change.Type, c.opt.Types, ok)
+		return ok
+	})
 
 	// filter by the existence of parent dir
 	changes = lo.Filter(changes, func(change git.Change, _ int) bool {
-		_, err := os.Stat(filepath.Dir(change.Path))
-		exist := err == nil
+		exist := c.exist.Exists(filepath.Dir(change.Path))
+		var ok bool
 		switch c.opt.DirExist {
 		case "true":
-			return exist
+			ok = exist
 		case "false":
-			return !exist
+			ok = !exist
 		default:
-			return true
+			ok = true
 		}
+		c.rec.filter(change, "dir-exist", ok, "parent dir %q exists: %v, wanted: %s", filepath.Dir(change.Path), exist, lo.Ternary(c.opt.DirExist == "", "all", c.opt.DirExist))
+		return ok
 	})
 
+	for _, change := range changes {
+		c.rec.include(change)
+	}
+
+	s := sorter{key: c.opt.Sort, reverse: c.opt.Reverse, fsys: c.exist}
 	files := c.getFiles(changes)
-	dirs := c.getDirs(changes)
+	s.files(files)
+	if c.sharding.index == nil {
+		if err := walkFiles(ctx, files, fn); err != nil {
+			return err
+		}
+		files = nil
+	}
 
-	if files == nil {
-		files = []File{}
+	dirs, err := c.getDirs(ctx, changes)
+	if err != nil {
+		return git.InPhase(ctx, "grouping changes", err)
 	}
-	if dirs == nil {
-		dirs = []Dir{}
+	files, dirs = c.sharding.apply(files, dirs, c.rec)
+	s.dirs(dirs)
+
+	if err := walkFiles(ctx, files, fn); err != nil {
+		return err
+	}
+	for i := range dirs {
+		if err := ctx.Err(); err != nil {
+			return git.InPhase(ctx, "writing dirs", err)
+		}
+		if err := fn(Entry{Dir: &dirs[i]}); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return Diff{
-		Files: files,
-		Dirs:  dirs,
-	}, nil
+func walkFiles(ctx context.Context, files []File, fn func(Entry) error) error {
+	for i := range files {
+		if err := ctx.Err(); err != nil {
+			return git.InPhase(ctx, "writing files", err)
+		}
+		if err := fn(Entry{File: &files[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c client) Run(ctx context.Context) (Diff, error) {
+	diff := Diff{Files: []File{}, Dirs: []Dir{}}
+	err := c.Walk(ctx, func(e Entry) error {
+		switch {
+		case e.File != nil:
+			diff.Files = append(diff.Files, *e.File)
+		case e.Dir != nil:
+			diff.Dirs = append(diff.Dirs, *e.Dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return Diff{}, err
+	}
+	return diff, nil
+}
+
+// Explain runs the detection and returns the decisions made for every
+// change, in the order of the changes.
+func (c client) Explain(ctx context.Context) ([]Explanation, error) {
+	c.rec = newRecorder(c.changes)
+	if _, err := c.Run(ctx); err != nil {
+		return nil, err
+	}
+	return c.rec.list(), nil
 }
 
 func (c client) getFiles(changes []git.Change) []File {
 	var files []File
 
 	for _, change := range changes {
-		files = append(files, getFile(change))
+		files = append(files, c.getFile(change))
 	}
 	return files
 }
 
-func (c client) getDirs(changes []git.Change) []Dir {
+func (c client) getDirs(ctx context.Context, changes []git.Change) ([]Dir, error) {
 	matrix := make(map[string]Dir)
-	for path, changes := range findDirWithPatterns(changes, c.opt.GroupBy) {
+	groups := groupChanges(changes, c.grouping, c.rec)
+	// in a stable order, as several groups may resolve to the same dir
+	paths := lo.Keys(groups)
+	sort.Strings(paths)
+	for _, path := range paths {
+		changes := groups[path]
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		resolvedPath := path
-		if c.opt.RootMarker != "" {
-			root := findRootByMarker(path, c.opt.RootMarker)
+		var marker rootMarker
+		var resolvedFrom string
+		if len(c.markers) > 0 {
+			var root string
+			steps := markerSteps(path, c.opt.RootMarkerCeiling, c.opt.RootMarkerMaxDepth)
+			root, marker = findRootByMarker(c.exist, steps, c.markers)
+			if root == "" && c.base != nil {
+				// the dir may have been deleted along with its marker
+				root, marker = findRootByMarker(c.base, steps, c.markers)
+				if root != "" {
+					resolvedFrom = ResolvedFromBase
+				}
+			}
 			if root == "" {
-				log.Printf("[DEBUG] getDirs: skipping %q: no root marker %q found in ancestors", path, c.opt.RootMarker)
+				log.Printf("[DEBUG] getDirs: skipping %q: no root marker %q found in %q", path, c.markers, steps)
+				for _, change := range changes {
+					c.rec.add(change, "root-marker", resultSkipped, "no file matching any of %q in %q", c.markers, steps)
+				}
 				continue
 			}
-			log.Printf("[DEBUG] getDirs: resolved %q -> %q by root-marker", path, root)
+			log.Printf("[DEBUG] getDirs: resolved %q -> %q by root-marker %q", path, root, marker)
+			for _, change := range changes {
+				c.rec.add(change, "root-marker", resultResolved, "%q has a file matching %q%s", root, marker, lo.Ternary(resolvedFrom == ResolvedFromBase, " in the base commit", ""))
+			}
 			resolvedPath = root
 		}
 		for _, change := range changes {
+			c.rec.group(change, resolvedPath)
 			dir, ok := matrix[resolvedPath]
 			if ok {
 				log.Printf("[TRACE] getDirs: updated %q", resolvedPath)
-				dir.Files = append(dir.Files, getFile(change))
+				dir.Files = append(dir.Files, c.getFile(change))
 			} else {
 				log.Printf("[TRACE] getDirs: created %q", resolvedPath)
 				dir = Dir{
-					Path: resolvedPath,
-					Exist: func() bool {
-						_, err := os.Stat(resolvedPath)
-						return err == nil
-					}(),
-					Files: []File{getFile(change)},
+					Path:         resolvedPath,
+					Exist:        c.exist.Exists(resolvedPath),
+					ExistInBase:  existIn(c.base, resolvedPath),
+					Files:        []File{c.getFile(change)},
+					Marker:       marker.text,
+					ResolvedFrom: resolvedFrom,
+				}
+				// the pattern and labels describe the reported dir, so a dir
+				// moved by a root marker only has them if it matches itself
+				if p, ok := c.grouping.lookup(resolvedPath); ok {
+					dir.Pattern = p.text
+					dir.Labels = p.match(resolvedPath)
 				}
 			}
 			matrix[resolvedPath] = dir
@@ -166,7 +419,23 @@ func (c client) getDirs(changes []git.Change) []Dir {
 	for _, dir := range matrix {
 		dirs = append(dirs, dir)
 	}
-	return dirs
+	return collapseDirs(dirs, c.opt.Collapse, c.rec), nil
+}
+
+// matchArgs reports whether path is one of args or is under one of them.
+// Unlike a plain string prefix, "app" matches "app/main.go" but not
+// "application/main.go". No args matches everything.
+func matchArgs(args []string, path string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	for _, arg := range args {
+		arg = filepath.Clean(arg)
+		if arg == "." || path == arg || strings.HasPrefix(path, arg+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 func getSteps(path string) []string {
@@ -182,67 +451,70 @@ func getSteps(path string) []string {
 	return steps
 }
 
-func findRootByMarker(dir string, marker string) string {
-	steps := getSteps(dir)
-	for _, step := range steps {
-		entries, err := os.ReadDir(step)
-		if err != nil {
-			continue
-		}
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-			matched, err := doublestar.Match(marker, entry.Name())
-			if err != nil {
-				continue
-			}
-			if matched {
-				return step
-			}
-		}
-	}
-	return ""
+func findDirWithPatterns(changes []git.Change, g grouping) map[string][]git.Change {
+	return groupChanges(changes, g, nil)
 }
 
-func findDirWithPatterns(changes []git.Change, patterns []string) map[string][]git.Change {
+// groupChanges is findDirWithPatterns recording its decisions to rec.
+func groupChanges(changes []git.Change, g grouping, rec *recorder) map[string][]git.Change {
 	found := make(map[string][]git.Change)
 
-	if len(patterns) == 0 {
+	if g.depth > 0 {
+		// If depth is specified, use the ancestor at that depth, or the
+		// parent directory if it is shallower
+		for _, change := range changes {
+			parentDir := filepath.Dir(change.Path)
+			dir, ok := g.dirAtDepth(parentDir)
+			if ok {
+				rec.add(change, "group-by", resultGrouped, "ancestor at depth %d is %q", g.depth, dir)
+			} else {
+				rec.add(change, "group-by", resultGrouped, "%q has no ancestor at depth %d: use parent dir", parentDir, g.depth)
+			}
+			found[dir] = append(found[dir], change)
+		}
+		return found
+	}
+
+	if len(g.patterns) == 0 {
 		// If no patterns are specified, use the direct parent directory of each file
 		for _, change := range changes {
 			parentDir := filepath.Dir(change.Path)
+			rec.add(change, "group-by", resultGrouped, "no patterns are given: use parent dir %q", parentDir)
 			found[parentDir] = append(found[parentDir], change)
 		}
 		return found
 	}
 
-	// If patterns are specified, use the minimum match
-	min := true
-
+	// If patterns are specified, use the match of the highest priority, and
+	// the shortest (or longest) one among them
 	for _, change := range changes {
 		steps := getSteps(filepath.Dir(change.Path))
-		var dirs []string
-		for _, pattern := range patterns {
-			dirs = append(dirs, lo.FilterMap(steps, func(step string, _ int) (string, bool) {
-				matched, _ := doublestar.Match(pattern, step)
+		var candidates []candidate
+		for _, p := range g.patterns {
+			matches := lo.FilterMap(steps, func(step string, _ int) (string, bool) {
+				matched, _ := doublestar.Match(p.pattern, step)
 				return step, matched
-			})...)
+			})
+			if len(matches) > 0 {
+				rec.add(change, "group-by", resultMatched, "pattern %q (priority %d) matched %q", p.pattern, p.priority, matches)
+			}
+			for _, match := range matches {
+				candidates = append(candidates, candidate{
+					dir:      match,
+					depth:    len(strings.Split(match, "/")),
+					priority: p.priority,
+				})
+			}
 		}
-		if len(dirs) == 0 {
+		if len(candidates) == 0 {
+			rec.add(change, "group-by", resultDropped, "no pattern of %q matched any of %q", lo.Map(g.patterns, func(p groupPattern, _ int) string {
+				return p.pattern
+			}), steps)
 			continue
 		}
-		var dir string
-		if min {
-			dir = lo.MinBy(dirs, func(item string, dir string) bool {
-				return len(strings.Split(item, "/")) < len(strings.Split(dir, "/"))
-			})
-		} else {
-			dir = lo.MaxBy(dirs, func(item string, dir string) bool {
-				return len(strings.Split(item, "/")) > len(strings.Split(dir, "/"))
-			})
-		}
-		found[dir] = append(found[dir], change)
+		best := lo.MinBy(candidates, g.better)
+		rec.add(change, "group-by", resultGrouped, "%s match of priority %d is %q", g.mode(), best.priority, best.dir)
+		found[best.dir] = append(found[best.dir], change)
 	}
 
 	return found
@@ -1,11 +1,16 @@
 package detect
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/babarot/changed-objects/internal/git"
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -14,6 +19,7 @@ func Test_findDirWithPatterns(t *testing.T) {
 		name     string
 		changes  []git.Change
 		patterns []string
+		match    string
 		want     map[string][]git.Change
 	}{
 		{
@@ -169,6 +175,77 @@ func Test_findDirWithPatterns(t *testing.T) {
 				"kubernetes/service-b/overlays/prod": {{Path: "kubernetes/service-b/overlays/prod/a.yaml", Type: git.Addition}},
 			},
 		},
+		{
+			name: "kubernetes: longest match",
+			changes: []git.Change{
+				{Path: "kubernetes/service-a/prod/README.md", Type: git.Addition},
+				{Path: "kubernetes/service-a/prod/Deployment/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition},
+			},
+			patterns: []string{"kubernetes/**"},
+			match:    MatchLongest,
+			want: map[string][]git.Change{
+				"kubernetes/service-a/prod":            {{Path: "kubernetes/service-a/prod/README.md", Type: git.Addition}},
+				"kubernetes/service-a/prod/Deployment": {{Path: "kubernetes/service-a/prod/Deployment/a.yaml", Type: git.Addition}},
+				"kubernetes/service-b/overlays/dev":    {{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition}},
+			},
+		},
+		{
+			name: "kubernetes: shortest match with overlapping patterns",
+			changes: []git.Change{
+				{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/prod/patches/a.yaml", Type: git.Addition},
+			},
+			patterns: []string{"kubernetes/*", "kubernetes/**/overlays/*"},
+			match:    MatchShortest,
+			want: map[string][]git.Change{
+				"kubernetes/service-a": {{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition}},
+				"kubernetes/service-b": {
+					{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition},
+					{Path: "kubernetes/service-b/overlays/prod/patches/a.yaml", Type: git.Addition},
+				},
+			},
+		},
+		{
+			name: "kubernetes: longest match with overlapping patterns",
+			changes: []git.Change{
+				{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/prod/patches/a.yaml", Type: git.Addition},
+			},
+			patterns: []string{"kubernetes/*", "kubernetes/**/overlays/*"},
+			match:    MatchLongest,
+			want: map[string][]git.Change{
+				"kubernetes/service-a":               {{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition}},
+				"kubernetes/service-b/overlays/dev":  {{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition}},
+				"kubernetes/service-b/overlays/prod": {{Path: "kubernetes/service-b/overlays/prod/patches/a.yaml", Type: git.Addition}},
+			},
+		},
+		{
+			name: "kubernetes: priority wins over shortest match",
+			changes: []git.Change{
+				{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition},
+				{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition},
+			},
+			patterns: []string{"kubernetes/**", "10:kubernetes/**/overlays/*"},
+			match:    MatchShortest,
+			want: map[string][]git.Change{
+				"kubernetes":                        {{Path: "kubernetes/service-a/base/a.yaml", Type: git.Addition}},
+				"kubernetes/service-b/overlays/dev": {{Path: "kubernetes/service-b/overlays/dev/a.yaml", Type: git.Addition}},
+			},
+		},
+		{
+			name: "kubernetes: priority wins over longest match",
+			changes: []git.Change{
+				{Path: "kubernetes/service-b/overlays/dev/Deployment/a.yaml", Type: git.Addition},
+			},
+			patterns: []string{"1:kubernetes/*", "kubernetes/**"},
+			match:    MatchLongest,
+			want: map[string][]git.Change{
+				"kubernetes/service-b": {{Path: "kubernetes/service-b/overlays/dev/Deployment/a.yaml", Type: git.Addition}},
+			},
+		},
 		{
 			name: "complex org structure: no patterns",
 			changes: []git.Change{
@@ -191,7 +268,79 @@ func Test_findDirWithPatterns(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got := findDirWithPatterns(tt.changes, tt.patterns)
+			g, err := newGrouping(tt.patterns, tt.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := findDirWithPatterns(tt.changes, g)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_findDirWithPatterns_depth(t *testing.T) {
+	changes := []git.Change{
+		{Path: "terraform/a/prod/x/y.tf", Type: git.Addition},
+		{Path: "terraform/a/prod/main.tf", Type: git.Addition},
+		{Path: "terraform/b/main.tf", Type: git.Addition},
+		{Path: "README.md", Type: git.Modification},
+	}
+
+	cases := []struct {
+		name  string
+		depth int
+		from  string
+		want  map[string][]git.Change
+	}{
+		{
+			name:  "ancestor at depth or parent dir if shallower",
+			depth: 3,
+			want: map[string][]git.Change{
+				"terraform/a/prod": {
+					{Path: "terraform/a/prod/x/y.tf", Type: git.Addition},
+					{Path: "terraform/a/prod/main.tf", Type: git.Addition},
+				},
+				"terraform/b": {
+					{Path: "terraform/b/main.tf", Type: git.Addition},
+				},
+				".": {
+					{Path: "README.md", Type: git.Modification},
+				},
+			},
+		},
+		{
+			name:  "depth below a prefix",
+			depth: 1,
+			from:  "terraform/",
+			want: map[string][]git.Change{
+				"terraform/a": {
+					{Path: "terraform/a/prod/x/y.tf", Type: git.Addition},
+					{Path: "terraform/a/prod/main.tf", Type: git.Addition},
+				},
+				"terraform/b": {
+					{Path: "terraform/b/main.tf", Type: git.Addition},
+				},
+				".": {
+					{Path: "README.md", Type: git.Modification},
+				},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			g, err := newGrouping(nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.setDepth(tt.depth, tt.from); err != nil {
+				t.Fatal(err)
+			}
+			got := findDirWithPatterns(changes, g)
 			if diff := cmp.Diff(got, tt.want); diff != "" {
 				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
 			}
@@ -304,7 +453,11 @@ func Test_findRootByMarker(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			dir := filepath.Join(tmpDir, tt.dir)
-			got := findRootByMarker(dir, tt.marker)
+			marker, err := newRootMarker(tt.marker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := findRootByMarker(osFS{}, markerSteps(dir, tmpDir, 0), []rootMarker{marker})
 			var want string
 			if tt.want != "" {
 				want = filepath.Join(tmpDir, tt.want)
@@ -315,3 +468,1040 @@ func Test_findRootByMarker(t *testing.T) {
 		})
 	}
 }
+
+func Test_findRootByMarker_multiple(t *testing.T) {
+	// tmpDir/
+	//   live/
+	//     terragrunt.hcl
+	//     prod/
+	//       main.tf        <- backend "s3"
+	//       modules/
+	//         vpc.tf       <- no backend
+	//   web/
+	//     package.json     <- workspaces
+	//     packages/app/
+	//       package.json   <- no workspaces
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"live/terragrunt.hcl":           "",
+		"live/prod/main.tf":             "terraform {\n  backend \"s3\" {}\n}\n",
+		"live/prod/modules/vpc.tf":      "resource \"aws_vpc\" \"this\" {}\n",
+		"web/package.json":              `{"workspaces": ["packages/*"]}`,
+		"web/packages/app/package.json": `{"name": "app"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name       string
+		dir        string
+		markers    []string
+		want       string
+		wantMarker string
+	}{
+		{
+			name:       "content predicate skips files without a match",
+			dir:        "live/prod/modules",
+			markers:    []string{`*.tf:^\s*backend\s+"`},
+			want:       "live/prod",
+			wantMarker: `*.tf:^\s*backend\s+"`,
+		},
+		{
+			name:       "earlier marker wins over a nearer later one",
+			dir:        "live/prod/modules",
+			markers:    []string{"terragrunt.hcl", "*.tf"},
+			want:       "live",
+			wantMarker: "terragrunt.hcl",
+		},
+		{
+			name:       "later marker is used when earlier ones are not found",
+			dir:        "web/packages/app",
+			markers:    []string{"terragrunt.hcl", `package.json:"workspaces"`},
+			want:       "web",
+			wantMarker: `package.json:"workspaces"`,
+		},
+		{
+			name:    "no marker found",
+			dir:     "web/packages/app",
+			markers: []string{"terragrunt.hcl", "*.tf"},
+			want:    "",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var markers []rootMarker
+			for _, text := range tt.markers {
+				marker, err := newRootMarker(text)
+				if err != nil {
+					t.Fatal(err)
+				}
+				markers = append(markers, marker)
+			}
+			got, marker := findRootByMarker(osFS{}, markerSteps(filepath.Join(tmpDir, tt.dir), tmpDir, 0), markers)
+			var want string
+			if tt.want != "" {
+				want = filepath.Join(tmpDir, tt.want)
+			}
+			if got != want || marker.text != tt.wantMarker {
+				t.Errorf("findRootByMarker(%q, %q) = %q, %q, want %q, %q", tt.dir, tt.markers, got, marker, want, tt.wantMarker)
+			}
+		})
+	}
+
+	if _, err := newRootMarker("*.tf:backend ("); err == nil {
+		t.Error("newRootMarker should fail for a bad regular expression")
+	}
+}
+
+func Test_markerSteps(t *testing.T) {
+	cases := []struct {
+		name     string
+		dir      string
+		ceiling  string
+		maxDepth int
+		want     []string
+	}{
+		{
+			name: "relative dir up to the repository root",
+			dir:  "terraform/a/prod",
+			want: []string{"terraform/a/prod", "terraform/a", "terraform", "."},
+		},
+		{
+			name:     "relative dir with max depth",
+			dir:      "terraform/a/prod",
+			maxDepth: 2,
+			want:     []string{"terraform/a/prod", "terraform/a"},
+		},
+		{
+			name:    "relative dir with a relative ceiling",
+			dir:     "terraform/a/prod",
+			ceiling: "terraform/",
+			want:    []string{"terraform/a/prod", "terraform/a", "terraform"},
+		},
+		{
+			name:    "relative dir outside a relative ceiling",
+			dir:     "kubernetes/a",
+			ceiling: "terraform",
+			want:    nil,
+		},
+		{
+			name:    "absolute dir with a ceiling",
+			dir:     "/repo/terraform/a",
+			ceiling: "/repo",
+			want:    []string{"/repo/terraform/a", "/repo/terraform", "/repo"},
+		},
+		{
+			name:    "dir outside the ceiling",
+			dir:     "/home/user",
+			ceiling: "/repo",
+			want:    nil,
+		},
+		{
+			name:    "dir next to the ceiling with a common prefix",
+			dir:     "/repo-2/a",
+			ceiling: "/repo",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := markerSteps(tt.dir, tt.ceiling, tt.maxDepth)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_matchRules(t *testing.T) {
+	var rules []rule
+	for _, text := range []string{
+		"docs/**",
+		"!docs/api/**",
+		"*.md",
+		"/vendor/",
+		"terraform/**/dev",
+		"!terraform/service-a/dev/keep.tf",
+		"deleted:archive/**",
+		"added,modified:shared/**",
+		"c:/windows",
+	} {
+		r, err := newRule(text, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+
+	cases := []struct {
+		change  git.Change
+		ignored bool
+		rule    string
+	}{
+		{change: git.Change{Path: "docs/guide/index.html"}, ignored: true, rule: "docs/**"},
+		{change: git.Change{Path: "docs/api/v1/index.html"}, ignored: false, rule: "!docs/api/**"},
+		{change: git.Change{Path: "README.md"}, ignored: true, rule: "*.md"},
+		{change: git.Change{Path: "docs/api/README.md"}, ignored: true, rule: "*.md"},
+		{change: git.Change{Path: "vendor/github.com/x/a.go"}, ignored: true, rule: "/vendor/"},
+		{change: git.Change{Path: "src/vendor/a.go"}, ignored: false, rule: ""},
+		{change: git.Change{Path: "terraform/service-a/dev/main.tf"}, ignored: true, rule: "terraform/**/dev"},
+		{change: git.Change{Path: "terraform/service-a/dev/child/main.tf"}, ignored: true, rule: "terraform/**/dev"},
+		{change: git.Change{Path: "terraform/service-a/dev/keep.tf"}, ignored: false, rule: "!terraform/service-a/dev/keep.tf"},
+		{change: git.Change{Path: "terraform/service-a/prod/main.tf"}, ignored: false, rule: ""},
+		{change: git.Change{Path: "archive/2020/main.tf", Type: git.Deletion}, ignored: true, rule: "deleted:archive/**"},
+		{change: git.Change{Path: "archive/2020/main.tf", Type: git.Addition}, ignored: false, rule: ""},
+		{change: git.Change{Path: "shared/lib.go", Type: git.Addition}, ignored: true, rule: "added,modified:shared/**"},
+		{change: git.Change{Path: "shared/lib.go", Type: git.Deletion}, ignored: false, rule: ""},
+		{change: git.Change{Path: "c:/windows/a.txt", Type: git.Deletion}, ignored: true, rule: "c:/windows"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.change.Path+" "+tt.change.Type.String(), func(t *testing.T) {
+			t.Parallel()
+			r, ignored := matchRules(rules, tt.change)
+			if ignored != tt.ignored || r.text != tt.rule {
+				t.Errorf("matchRules(%v) = (%q, %v), want (%q, %v)", tt.change, r.text, ignored, tt.rule, tt.ignored)
+			}
+		})
+	}
+}
+
+func Test_matchArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		path string
+		want bool
+	}{
+		{name: "no args", args: nil, path: "app/main.go", want: true},
+		{name: "dir", args: []string{"app"}, path: "app/main.go", want: true},
+		{name: "nested dir", args: []string{"app"}, path: "app/cmd/main.go", want: true},
+		{name: "trailing slash", args: []string{"app/"}, path: "app/main.go", want: true},
+		{name: "dot slash", args: []string{"./app"}, path: "app/main.go", want: true},
+		{name: "same prefix", args: []string{"app"}, path: "application/main.go", want: false},
+		{name: "file", args: []string{"app/main.go"}, path: "app/main.go", want: true},
+		{name: "current dir", args: []string{"."}, path: "main.go", want: true},
+		{name: "any of args", args: []string{"lib", "app"}, path: "app/main.go", want: true},
+		{name: "none of args", args: []string{"lib", "cmd"}, path: "app/main.go", want: false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matchArgs(tt.args, tt.path); got != tt.want {
+				t.Errorf("matchArgs(%q, %q) = %v, want %v", tt.args, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_includeAndIgnore(t *testing.T) {
+	changes := []git.Change{
+		{Path: "terraform/a/main.tf", Type: git.Modification},
+		{Path: "terraform/a/README.md", Type: git.Modification},
+		{Path: "terraform/a/old.tf", Type: git.Deletion},
+		{Path: "terraform/b/main.tf", Type: git.Modification},
+		{Path: "terraform-modules/c/main.tf", Type: git.Modification},
+		{Path: "app/main.go", Type: git.Modification},
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		opt  Option
+		want []string
+	}{
+		{
+			name: "positional args match on component boundaries",
+			args: []string{"terraform"},
+			want: []string{"terraform/a/README.md", "terraform/a/main.tf", "terraform/a/old.tf", "terraform/b/main.tf"},
+		},
+		{
+			name: "include matches full file paths",
+			opt:  Option{Includes: []string{"**/*.tf"}},
+			want: []string{"terraform-modules/c/main.tf", "terraform/a/main.tf", "terraform/a/old.tf", "terraform/b/main.tf"},
+		},
+		{
+			name: "args and include are both required",
+			args: []string{"terraform"},
+			opt:  Option{Includes: []string{"**/*.tf"}},
+			want: []string{"terraform/a/main.tf", "terraform/a/old.tf", "terraform/b/main.tf"},
+		},
+		{
+			name: "include restricted to a change type",
+			opt:  Option{Includes: []string{"modified:terraform/a/**", "app/**"}},
+			want: []string{"app/main.go", "terraform/a/README.md", "terraform/a/main.tf"},
+		},
+		{
+			name: "ignore wins over include",
+			opt:  Option{Includes: []string{"**/*.tf"}, Ignores: []string{"terraform/b/", "deleted:terraform/**"}},
+			want: []string{"terraform-modules/c/main.tf", "terraform/a/main.tf"},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := NewWithChanges(tt.args, changes, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff, err := c.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range diff.Files {
+				got = append(got, file.Path)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	changes := []git.Change{
+		{Path: "terraform/a/prod/main.tf", Type: git.Modification},
+		{Path: "archive/b/main.tf", Type: git.Deletion},
+		{Path: "docs/index.md", Type: git.Addition},
+	}
+	c, err := NewWithChanges(nil, changes, Option{
+		Ignores: []string{"deleted:archive/**"},
+		GroupBy: []string{"terraform/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanations, err := c.Explain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Path     string
+		Included bool
+		Dir      string
+		Last     Decision
+	}
+	var got []summary
+	for _, e := range explanations {
+		got = append(got, summary{Path: e.Path, Included: e.Included, Dir: e.Dir, Last: e.Decisions[len(e.Decisions)-1]})
+	}
+
+	want := []summary{
+		{
+			Path: "terraform/a/prod/main.tf", Included: true, Dir: "terraform/a",
+			Last: Decision{Stage: "group-by", Result: "grouped", Reason: `shortest match of priority 0 is "terraform/a"`},
+		},
+		{
+			Path: "archive/b/main.tf", Included: false, Dir: "",
+			Last: Decision{Stage: "ignore", Result: "dropped", Reason: `ignored by "deleted:archive/**" (--ignore)`},
+		},
+		{
+			Path: "docs/index.md", Included: true, Dir: "",
+			Last: Decision{Stage: "group-by", Result: "dropped", Reason: `no pattern of ["terraform/*"] matched any of ["docs"]`},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestRun_groupByLabels(t *testing.T) {
+	changes := []git.Change{
+		{Path: "terraform/a/prod/main.tf", Type: git.Modification},
+		{Path: "terraform/b/dev/main.tf", Type: git.Modification},
+		{Path: "modules/vpc/main.tf", Type: git.Modification},
+	}
+
+	c, err := NewWithChanges(nil, changes, Option{
+		GroupBy: []string{"terraform/{service}/{env}", "10:modules/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type dir struct {
+		Path    string
+		Pattern string
+		Labels  map[string]string
+	}
+	var got []dir
+	for _, d := range diff.Dirs {
+		got = append(got, dir{Path: d.Path, Pattern: d.Pattern, Labels: d.Labels})
+	}
+	want := []dir{
+		{Path: "modules/vpc", Pattern: "modules/*"},
+		{Path: "terraform/a/prod", Pattern: "terraform/{service}/{env}", Labels: map[string]string{"service": "a", "env": "prod"}},
+		{Path: "terraform/b/dev", Pattern: "terraform/{service}/{env}", Labels: map[string]string{"service": "b", "env": "dev"}},
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestRun_groupByLabelsWithRootMarker(t *testing.T) {
+	changes := []git.Change{
+		{Path: "terraform/a/prod/main.tf", Type: git.Modification},
+		{Path: "terraform/a/prod/x/a.json", Type: git.Modification},
+		{Path: "terraform/a/prod/y/b.json", Type: git.Modification},
+		{Path: "terraform/b/dev/z/main.tf", Type: git.Modification},
+	}
+	fsys := mapFS{
+		"terraform/a/prod/main.tf":  "",
+		"terraform/a/prod/x/a.json": "",
+		"terraform/a/prod/y/b.json": "",
+		"terraform/b/dev/z/main.tf": "",
+	}
+
+	type dir struct {
+		Path    string
+		Pattern string
+		Labels  map[string]string
+	}
+	// terraform/a/prod/x and y are moved to terraform/a/prod, which does
+	// not match the pattern, so it has no labels rather than those of x or y
+	want := []dir{
+		{Path: "terraform/a/prod"},
+		{Path: "terraform/b/dev/z", Pattern: "terraform/{svc}/{env}/{sub}", Labels: map[string]string{"svc": "b", "env": "dev", "sub": "z"}},
+	}
+
+	// the groups are visited in a random order
+	for i := 0; i < 20; i++ {
+		c, err := NewWithChanges(nil, changes, Option{
+			GroupBy:     []string{"terraform/{svc}/{env}/{sub}"},
+			RootMarkers: []string{"main.tf"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.exist = fsys
+		diff, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []dir
+		for _, d := range diff.Dirs {
+			got = append(got, dir{Path: d.Path, Pattern: d.Pattern, Labels: d.Labels})
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Fatalf("Result is mismatch (-got +want):\n%s", diff)
+		}
+	}
+}
+
+func Test_groupPattern_match(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		dir     string
+		want    map[string]string
+	}{
+		{
+			name:    "no placeholders",
+			pattern: "terraform/*/*",
+			dir:     "terraform/a/prod",
+			want:    nil,
+		},
+		{
+			name:    "placeholders",
+			pattern: "terraform/{service}/{env}",
+			dir:     "terraform/a/prod",
+			want:    map[string]string{"service": "a", "env": "prod"},
+		},
+		{
+			name:    "placeholder after doublestar",
+			pattern: "kubernetes/**/overlays/{env}",
+			dir:     "kubernetes/x/y/overlays/dev",
+			want:    map[string]string{"env": "dev"},
+		},
+		{
+			name:    "placeholder next to an alternation",
+			pattern: "{apps,services}/{name}",
+			dir:     "services/api",
+			want:    map[string]string{"name": "api"},
+		},
+		{
+			name:    "placeholder with a literal part",
+			pattern: "stacks/{name}.d",
+			dir:     "stacks/web.d",
+			want:    map[string]string{"name": "web"},
+		},
+		{
+			name:    "trailing doublestar matching no components",
+			pattern: "{top}/**",
+			dir:     "app",
+			want:    map[string]string{"top": "app"},
+		},
+		{
+			name:    "trailing doublestar matching components",
+			pattern: "{top}/**",
+			dir:     "app/x/y",
+			want:    map[string]string{"top": "app"},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := newGroupPattern(tt.pattern, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := doublestar.Match(p.pattern, tt.dir); !ok {
+				t.Fatalf("%q should match %q", p.pattern, tt.dir)
+			}
+			if diff := cmp.Diff(p.match(tt.dir), tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_collapseDirs(t *testing.T) {
+	file := func(path string) File {
+		return File{Name: filepath.Base(path), Path: path, Type: git.Modification}
+	}
+	dirs := []Dir{
+		{Path: "terraform/a/prod/child", Files: []File{file("terraform/a/prod/child/a.tf")}},
+		{Path: "terraform/a/prod", Files: []File{file("terraform/a/prod/a.tf")}},
+		{Path: "terraform/a/prod/child/grandchild", Files: []File{file("terraform/a/prod/child/grandchild/a.tf")}},
+		{Path: "terraform/a/prod-2", Files: []File{file("terraform/a/prod-2/a.tf")}},
+		{Path: ".", Files: []File{file("README.md")}},
+	}
+
+	cases := []struct {
+		name string
+		mode string
+		want map[string][]string
+	}{
+		{
+			name: "none",
+			mode: CollapseNone,
+			want: map[string][]string{
+				".":                                 {"README.md"},
+				"terraform/a/prod":                  {"terraform/a/prod/a.tf"},
+				"terraform/a/prod/child":            {"terraform/a/prod/child/a.tf"},
+				"terraform/a/prod/child/grandchild": {"terraform/a/prod/child/grandchild/a.tf"},
+				"terraform/a/prod-2":                {"terraform/a/prod-2/a.tf"},
+			},
+		},
+		{
+			name: "ancestor",
+			mode: CollapseAncestor,
+			want: map[string][]string{
+				".":                  {"README.md"},
+				"terraform/a/prod":   {"terraform/a/prod/a.tf", "terraform/a/prod/child/a.tf", "terraform/a/prod/child/grandchild/a.tf"},
+				"terraform/a/prod-2": {"terraform/a/prod-2/a.tf"},
+			},
+		},
+		{
+			name: "descendant",
+			mode: CollapseDescendant,
+			want: map[string][]string{
+				".":                                 {"README.md"},
+				"terraform/a/prod/child/grandchild": {"terraform/a/prod/child/grandchild/a.tf"},
+				"terraform/a/prod-2":                {"terraform/a/prod-2/a.tf"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := map[string][]string{}
+			for _, dir := range collapseDirs(dirs, tt.mode, nil) {
+				for _, file := range dir.Files {
+					got[dir.Path] = append(got[dir.Path], file.Path)
+				}
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+// mapFS is a fileSystem of the given files, keyed by path.
+type mapFS map[string]string
+
+func (m mapFS) ListFiles(dir string) ([]string, error) {
+	var names []string
+	for path := range m {
+		if filepath.Dir(path) == dir {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	if names == nil {
+		return nil, os.ErrNotExist
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m mapFS) ReadFile(path string) ([]byte, error) {
+	content, ok := m[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+func (m mapFS) Size(path string) int64 {
+	return int64(len(m[path]))
+}
+
+func (m mapFS) Exists(path string) bool {
+	for p := range m {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRun_rootMarkerFromBase(t *testing.T) {
+	// stacks/deleted was removed along with its marker, so it exists only in
+	// the base commit
+	changes := []git.Change{
+		{Path: "stacks/deleted/main.tf", Type: git.Deletion},
+		{Path: "stacks/deleted/modules/vpc.tf", Type: git.Deletion},
+		{Path: "stacks/unknown/main.go", Type: git.Deletion},
+	}
+	c, err := NewWithChanges(nil, changes, Option{RootMarkers: []string{"main.tf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.base = mapFS{
+		"stacks/deleted/main.tf":        "",
+		"stacks/deleted/modules/vpc.tf": "",
+		"stacks/unknown/main.go":        "",
+	}
+
+	diff, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type dir struct {
+		Path         string
+		Exist        bool
+		ResolvedFrom string
+		Files        int
+	}
+	var got []dir
+	for _, d := range diff.Dirs {
+		got = append(got, dir{Path: d.Path, Exist: d.Exist, ResolvedFrom: d.ResolvedFrom, Files: len(d.Files)})
+	}
+	want := []dir{
+		{Path: "stacks/deleted", Exist: false, ResolvedFrom: ResolvedFromBase, Files: 2},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestRun_existFrom(t *testing.T) {
+	changes := []git.Change{
+		{Path: "stacks/a/main.tf", Type: git.Modification},
+		{Path: "stacks/b/main.tf", Type: git.Deletion},
+	}
+	head := mapFS{"stacks/a/main.tf": ""}
+	base := mapFS{"stacks/a/main.tf": "", "stacks/b/main.tf": ""}
+	yes := true
+
+	type dir struct {
+		Path        string
+		Exist       bool
+		ExistInBase *bool
+		ParentDir   ParentDir
+	}
+	cases := []struct {
+		name     string
+		dirExist string
+		want     []dir
+	}{
+		{
+			name: "all",
+			want: []dir{
+				{Path: "stacks/a", Exist: true, ExistInBase: &yes, ParentDir: ParentDir{Path: "stacks/a", Exist: true, ExistInBase: &yes}},
+				{Path: "stacks/b", Exist: false, ExistInBase: &yes, ParentDir: ParentDir{Path: "stacks/b", Exist: false, ExistInBase: &yes}},
+			},
+		},
+		{
+			name:     "dir-exist is checked in the tree",
+			dirExist: "false",
+			want: []dir{
+				{Path: "stacks/b", Exist: false, ExistInBase: &yes, ParentDir: ParentDir{Path: "stacks/b", Exist: false, ExistInBase: &yes}},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := newClient(nil, changes, Option{ExistFrom: ExistFromHead, DirExist: tt.dirExist})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.exist, c.base = head, base
+
+			diff, err := c.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []dir
+			for _, d := range diff.Dirs {
+				got = append(got, dir{Path: d.Path, Exist: d.Exist, ExistInBase: d.ExistInBase, ParentDir: d.Files[0].ParentDir})
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := NewWithChanges(nil, changes, Option{ExistFrom: ExistFromHead}); err == nil {
+		t.Error("NewWithChanges should fail for exist-from head")
+	}
+}
+
+func TestRun_sort(t *testing.T) {
+	changes := []git.Change{
+		{Path: "b/main.tf", Type: git.Modification},
+		{Path: "a/big.tf", Type: git.Deletion},
+		{Path: "c/x.tf", Type: git.Addition},
+		{Path: "c/y.tf", Type: git.Modification},
+		{Path: "b/main.tf", Type: git.Modification},
+	}
+	fsys := mapFS{
+		"a/big.tf":  strings.Repeat("x", 100),
+		"b/main.tf": strings.Repeat("x", 10),
+		"c/x.tf":    strings.Repeat("x", 20),
+		"c/y.tf":    strings.Repeat("x", 30),
+	}
+
+	cases := []struct {
+		name      string
+		opt       Option
+		wantFiles []string
+		wantDirs  []string
+	}{
+		{
+			name:      "path by default",
+			wantFiles: []string{"a/big.tf", "b/main.tf", "c/x.tf", "c/y.tf"},
+			wantDirs:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "reverse",
+			opt:       Option{Reverse: true},
+			wantFiles: []string{"c/y.tf", "c/x.tf", "b/main.tf", "a/big.tf"},
+			wantDirs:  []string{"c", "b", "a"},
+		},
+		{
+			name:      "type",
+			opt:       Option{Sort: SortType},
+			wantFiles: []string{"c/x.tf", "a/big.tf", "b/main.tf", "c/y.tf"},
+			wantDirs:  []string{"c", "a", "b"},
+		},
+		{
+			name:      "size",
+			opt:       Option{Sort: SortSize},
+			wantFiles: []string{"a/big.tf", "c/y.tf", "c/x.tf", "b/main.tf"},
+			wantDirs:  []string{"a", "c", "b"},
+		},
+		{
+			name:      "changes",
+			opt:       Option{Sort: SortChanges},
+			wantFiles: []string{"a/big.tf", "b/main.tf", "c/x.tf", "c/y.tf"},
+			wantDirs:  []string{"c", "a", "b"},
+		},
+		{
+			name:      "multiple types keep the order without duplicates",
+			opt:       Option{Types: []string{"modified", "added", "modified"}},
+			wantFiles: []string{"b/main.tf", "c/x.tf", "c/y.tf"},
+			wantDirs:  []string{"b", "c"},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, err := NewWithChanges(nil, changes, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.exist = fsys
+
+			diff, err := c.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := struct{ Files, Dirs []string }{}
+			for _, file := range diff.Files {
+				got.Files = append(got.Files, file.Path)
+			}
+			for _, dir := range diff.Dirs {
+				got.Dirs = append(got.Dirs, dir.Path)
+			}
+			want := struct{ Files, Dirs []string }{tt.wantFiles, tt.wantDirs}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRun_shards(t *testing.T) {
+	changes := []git.Change{
+		{Path: "a/1.tf", Type: git.Modification},
+		{Path: "a/2.tf", Type: git.Modification},
+		{Path: "a/3.tf", Type: git.Modification},
+		{Path: "b/1.tf", Type: git.Modification},
+		{Path: "b/2.tf", Type: git.Modification},
+		{Path: "c/1.tf", Type: git.Modification},
+		{Path: "d/1.tf", Type: git.Modification},
+	}
+	run := func(t *testing.T, opt Option) Diff {
+		t.Helper()
+		c, err := NewWithChanges(nil, changes, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.exist = mapFS{}
+		diff, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return diff
+	}
+
+	// the heaviest dir a is alone with one of the lightest c and d
+	shards := map[string]int{}
+	loads := make([]int, 2)
+	for _, dir := range run(t, Option{Shards: 2}).Dirs {
+		if dir.Shard == nil {
+			t.Fatalf("dir %q has no shard", dir.Path)
+		}
+		shards[dir.Path] = *dir.Shard
+		loads[*dir.Shard] += len(dir.Files)
+	}
+	if diff := cmp.Diff(loads, []int{4, 3}); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+	if shards["a"] == shards["b"] || shards["c"] == shards["d"] {
+		t.Errorf("unbalanced shards: %v", shards)
+	}
+
+	// the same input gives the same shards, and each index keeps its dirs
+	// and their files
+	for index := 0; index < 2; index++ {
+		index := index
+		diff := run(t, Option{Shards: 2, ShardIndex: &index})
+		var wantDirs, gotDirs, wantFiles, gotFiles []string
+		for _, dir := range []string{"a", "b", "c", "d"} {
+			if shards[dir] == index {
+				wantDirs = append(wantDirs, dir)
+			}
+		}
+		for _, change := range changes {
+			if shards[filepath.Dir(change.Path)] == index {
+				wantFiles = append(wantFiles, change.Path)
+			}
+		}
+		for _, dir := range diff.Dirs {
+			gotDirs = append(gotDirs, dir.Path)
+		}
+		for _, file := range diff.Files {
+			gotFiles = append(gotFiles, file.Path)
+		}
+		if diff := cmp.Diff([][]string{gotDirs, gotFiles}, [][]string{wantDirs, wantFiles}); diff != "" {
+			t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+		}
+	}
+
+	// weights override the numbers of files
+	weighted := map[string]int{}
+	for _, dir := range run(t, Option{Shards: 2, ShardWeights: []string{"c=10"}}).Dirs {
+		weighted[dir.Path] = *dir.Shard
+	}
+	if weighted["c"] == weighted["a"] || weighted["c"] == weighted["b"] || weighted["c"] == weighted["d"] {
+		t.Errorf("dir c should be alone in its shard: %v", weighted)
+	}
+}
+
+func Test_newSharding(t *testing.T) {
+	index := func(i int) *int { return &i }
+	cases := []struct {
+		name    string
+		n       int
+		index   *int
+		weights []string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "shards", n: 3, index: index(2), weights: []string{"terraform/**=5"}},
+		{name: "negative shards", n: -1, wantErr: true},
+		{name: "index without shards", index: index(0), wantErr: true},
+		{name: "weights without shards", weights: []string{"a=1"}, wantErr: true},
+		{name: "index out of range", n: 2, index: index(2), wantErr: true},
+		{name: "weight without pattern", n: 2, weights: []string{"=1"}, wantErr: true},
+		{name: "weight without weight", n: 2, weights: []string{"a"}, wantErr: true},
+		{name: "zero weight", n: 2, weights: []string{"a=0"}, wantErr: true},
+		{name: "bad pattern", n: 2, weights: []string{"a/[=1"}, wantErr: true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := newSharding(tt.n, tt.index, tt.weights)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newSharding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	changes := []git.Change{
+		{Path: "b/main.tf", Type: git.Modification},
+		{Path: "a/main.tf", Type: git.Addition},
+		{Path: "a/x.tf", Type: git.Addition},
+	}
+	c, err := NewWithChanges(nil, changes, Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.exist = mapFS{}
+
+	var got []string
+	err = c.Walk(context.Background(), func(e Entry) error {
+		switch {
+		case e.File != nil:
+			got = append(got, "file "+e.File.Path)
+		case e.Dir != nil:
+			got = append(got, "dir "+e.Dir.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"file a/main.tf", "file a/x.tf", "file b/main.tf", "dir a", "dir b"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+
+	// Walk stops at the first error
+	stop := errors.New("stop")
+	n := 0
+	err = c.Walk(context.Background(), func(Entry) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("Walk() = %v after %d entries, want %v after 1", err, n, stop)
+	}
+}
+
+func Test_readIgnoreFile(t *testing.T) {
+	type ruleText struct {
+		Text   string
+		Source string
+	}
+	cases := []struct {
+		name    string
+		content string
+		want    []ruleText
+		wantErr string
+	}{
+		{
+			name:    "comments and blank lines",
+			content: "# comment\n\ndocs/**\n   \n!docs/api/**\n",
+			want: []ruleText{
+				{Text: "docs/**", Source: "IGNORE:3"},
+				{Text: "!docs/api/**", Source: "IGNORE:5"},
+			},
+		},
+		{
+			name:    "escaped #",
+			content: "\\#notes.md\n#notes.md\n",
+			want: []ruleText{
+				{Text: "#notes.md", Source: "IGNORE:1"},
+			},
+		},
+		{
+			name:    "CRLF",
+			content: "*.md\r\n\r\n/api\r\n",
+			want: []ruleText{
+				{Text: "*.md", Source: "IGNORE:1"},
+				{Text: "/api", Source: "IGNORE:3"},
+			},
+		},
+		{
+			name:    "error with line number",
+			content: "docs/**\n# comment\ndeleted:\n",
+			wantErr: "IGNORE:3: empty pattern",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), IgnoreFileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := readIgnoreFile(path)
+			if tt.wantErr != "" {
+				want := strings.ReplaceAll(tt.wantErr, "IGNORE", path)
+				if err == nil || !strings.HasPrefix(err.Error(), want) {
+					t.Fatalf("readIgnoreFile() error = %v, want prefix %q", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []ruleText
+			for _, r := range rules {
+				got = append(got, ruleText{Text: r.text, Source: strings.ReplaceAll(r.source, path, "IGNORE")})
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package detect
+
+import (
+	"fmt"
+
+	"github.com/babarot/changed-objects/internal/git"
+)
+
+// Explanation is the sequence of decisions made for a changed file.
+type Explanation struct {
+	Path string   `json:"path"`
+	Type git.Type `json:"type"`
+	// Included reports whether the file passed all the filters and is
+	// listed in Diff.Files.
+	Included bool `json:"included"`
+	// Dir is the path of the Dir the file is grouped into, if any.
+	Dir       string     `json:"dir"`
+	Decisions []Decision `json:"decisions"`
+}
+
+type Decision struct {
+	Stage  string `json:"stage"`
+	Result string `json:"result"`
+	Reason string `json:"reason"`
+}
+
+const (
+	resultKept     = "kept"
+	resultDropped  = "dropped"
+	resultMatched  = "matched"
+	resultGrouped  = "grouped"
+	resultResolved = "resolved"
+	resultSkipped  = "skipped"
+)
+
+// recorder collects the decisions made in Run. A nil recorder records
+// nothing, so that Run does not pay for explanations unless asked.
+type recorder struct {
+	order        []git.Change
+	explanations map[git.Change]*Explanation
+}
+
+func newRecorder(changes []git.Change) *recorder {
+	r := &recorder{explanations: map[git.Change]*Explanation{}}
+	for _, change := range changes {
+		if _, ok := r.explanations[change]; ok {
+			continue
+		}
+		r.order = append(r.order, change)
+		r.explanations[change] = &Explanation{
+			Path:      change.Path,
+			Type:      change.Type,
+			Decisions: []Decision{},
+		}
+	}
+	return r
+}
+
+func (r *recorder) add(change git.Change, stage, result, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	e, ok := r.explanations[change]
+	if !ok {
+		return
+	}
+	e.Decisions = append(e.Decisions, Decision{
+		Stage:  stage,
+		Result: result,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// filter records the result of a filter stage.
+func (r *recorder) filter(change git.Change, stage string, kept bool, format string, args ...any) {
+	result := resultDropped
+	if kept {
+		result = resultKept
+	}
+	r.add(change, stage, result, format, args...)
+}
+
+func (r *recorder) include(change git.Change) {
+	if r == nil {
+		return
+	}
+	if e, ok := r.explanations[change]; ok {
+		e.Included = true
+	}
+}
+
+// exclude undoes include for a file dropped after grouping.
+func (r *recorder) exclude(change git.Change) {
+	if r == nil {
+		return
+	}
+	if e, ok := r.explanations[change]; ok {
+		e.Included = false
+		e.Dir = ""
+	}
+}
+
+func (r *recorder) group(change git.Change, dir string) {
+	if r == nil {
+		return
+	}
+	if e, ok := r.explanations[change]; ok {
+		e.Dir = dir
+	}
+}
+
+func (r *recorder) list() []Explanation {
+	explanations := make([]Explanation, 0, len(r.order))
+	for _, change := range r.order {
+		explanations = append(explanations, *r.explanations[change])
+	}
+	return explanations
+}
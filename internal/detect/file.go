@@ -1,7 +1,6 @@
 package detect
 
 import (
-	"os"
 	"path/filepath"
 
 	"github.com/babarot/changed-objects/internal/git"
@@ -17,30 +16,60 @@ type File struct {
 type ParentDir struct {
 	Path  string `json:"path"`
 	Exist bool   `json:"exist"`
+	// ExistInBase reports whether the dir exists in the base commit. It is
+	// nil if the base commit is not known.
+	ExistInBase *bool `json:"exist_in_base,omitempty"`
 }
 
 type Dir struct {
 	Path  string `json:"path"`
 	Exist bool   `json:"exist"`
-	Files []File `json:"files"`
+	// ExistInBase reports whether the dir exists in the base commit. It is
+	// nil if the base commit is not known.
+	ExistInBase *bool  `json:"exist_in_base,omitempty"`
+	Files       []File `json:"files"`
+	// Pattern is the group-by pattern the dir was grouped by.
+	Pattern string `json:"pattern,omitempty"`
+	// Labels are the values of the named placeholders of Pattern, e.g.
+	// {"service": "a"} for terraform/{service}/*.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Marker is the root marker found in the dir, if it was resolved by
+	// one.
+	Marker string `json:"marker,omitempty"`
+	// ResolvedFrom is ResolvedFromBase if the marker was found in the base
+	// commit instead of the working tree, e.g. for a deleted dir.
+	ResolvedFrom string `json:"resolved_from,omitempty"`
+	// Shard is the shard the dir is assigned to when results are
+	// sharded.
+	Shard *int `json:"shard,omitempty"`
 }
 
+// ResolvedFromBase is Dir.ResolvedFrom for a dir resolved from the base
+// commit.
+const ResolvedFromBase = "base"
+
 type Diff struct {
 	Files []File `json:"files"`
 	Dirs  []Dir  `json:"dirs"`
 }
 
-func getFile(change git.Change) File {
+// Entry is a file or a dir of a Diff passed to the callback of Walk. Either
+// File or Dir is set.
+type Entry struct {
+	File *File `json:"file,omitempty"`
+	Dir  *Dir  `json:"dir,omitempty"`
+}
+
+func (c client) getFile(change git.Change) File {
+	parentDir := filepath.Dir(change.Path)
 	return File{
 		Name: filepath.Base(change.Path),
 		Path: change.Path,
 		Type: change.Type,
 		ParentDir: ParentDir{
-			Path: filepath.Dir(change.Path),
-			Exist: func() bool {
-				_, err := os.Stat(filepath.Dir(change.Path))
-				return err == nil
-			}(),
+			Path:        parentDir,
+			Exist:       c.exist.Exists(parentDir),
+			ExistInBase: existIn(c.base, parentDir),
 		},
 	}
 }
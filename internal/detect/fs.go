@@ -0,0 +1,73 @@
+package detect
+
+import (
+	"os"
+
+	"github.com/babarot/changed-objects/internal/git"
+)
+
+const (
+	ExistFromWorktree = "worktree"
+	ExistFromHead     = "head"
+)
+
+// fileSystem is where root markers are looked up and the existence of paths
+// is checked: the working tree, or the tree of a commit.
+type fileSystem interface {
+	// ListFiles returns the names of the files in dir, not including
+	// directories.
+	ListFiles(dir string) ([]string, error)
+	ReadFile(path string) ([]byte, error)
+	Exists(path string) bool
+	// Size returns the size of the file at path, or 0 if there is none.
+	Size(path string) int64
+}
+
+var (
+	_ fileSystem = osFS{}
+	_ fileSystem = (*git.Tree)(nil)
+)
+
+// osFS is the working tree, with paths relative to the current directory.
+type osFS struct{}
+
+func (osFS) ListFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (osFS) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (osFS) Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (osFS) Size(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
+
+// existIn reports whether path exists in fsys, or returns nil if fsys is not
+// known.
+func existIn(fsys fileSystem, path string) *bool {
+	if fsys == nil {
+		return nil
+	}
+	exist := fsys.Exists(path)
+	return &exist
+}
@@ -0,0 +1,262 @@
+package detect
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	MatchShortest = "shortest"
+	MatchLongest  = "longest"
+)
+
+// groupPattern is a --group-by pattern. When the patterns match several
+// ancestors of a change, the ones of the highest priority are preferred.
+type groupPattern struct {
+	// text is the pattern as given, without the priority
+	text string
+	// pattern is text with its placeholders replaced by *
+	pattern  string
+	priority int
+	// labels extracts the values of the placeholders, or is nil if the
+	// pattern has none
+	labels *regexp.Regexp
+}
+
+// placeholderRe matches a named placeholder such as {service}. Unlike an
+// alternation such as {dev,prod}, it has no comma.
+var placeholderRe = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func newGroupPattern(text string, priority int) (groupPattern, error) {
+	p := groupPattern{
+		text:     text,
+		pattern:  placeholderRe.ReplaceAllString(text, "*"),
+		priority: priority,
+	}
+	if !doublestar.ValidatePattern(p.pattern) {
+		return groupPattern{}, fmt.Errorf("bad group-by pattern: %q", text)
+	}
+	if p.pattern != text {
+		re, err := regexp.Compile(labelsRegexp(text))
+		if err != nil {
+			return groupPattern{}, fmt.Errorf("bad group-by pattern: %q: %w", text, err)
+		}
+		p.labels = re
+	}
+	return p, nil
+}
+
+// labelsRegexp translates a glob pattern with placeholders into a regular
+// expression capturing each placeholder as a named group.
+func labelsRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	alts := 0
+	for i := 0; i < len(pattern); i++ {
+		if loc := placeholderRe.FindStringSubmatchIndex(pattern[i:]); loc != nil && loc[0] == 0 {
+			fmt.Fprintf(&b, "(?P<%s>[^/]+)", pattern[i+loc[2]:i+loc[3]])
+			i += loc[1] - 1
+			continue
+		}
+		switch c := pattern[i]; c {
+		case '/':
+			// a trailing /** also matches zero path components
+			if pattern[i:] == "/**" {
+				b.WriteString("(?:/.*)?")
+				i += 2
+				continue
+			}
+			b.WriteString("/")
+		case '*':
+			switch {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				b.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '{':
+			alts++
+			b.WriteString("(?:")
+		case '}':
+			alts--
+			b.WriteString(")")
+		case ',':
+			if alts > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// match returns the values of the placeholders of p in dir, or nil if p has
+// no placeholders.
+func (p groupPattern) match(dir string) map[string]string {
+	if p.labels == nil {
+		return nil
+	}
+	m := p.labels.FindStringSubmatch(dir)
+	if m == nil {
+		return nil
+	}
+	labels := map[string]string{}
+	for i, name := range p.labels.SubexpNames() {
+		if name != "" {
+			labels[name] = m[i]
+		}
+	}
+	return labels
+}
+
+// grouping decides which directory a change is grouped into.
+type grouping struct {
+	patterns []groupPattern
+	// longest prefers the deepest matching ancestor instead of the
+	// shallowest one
+	longest bool
+	// depth groups changes by their ancestor at that depth below depthFrom
+	// instead of by patterns, if not zero
+	depth     int
+	depthFrom string
+}
+
+// newGrouping parses patterns, which may be prefixed with a priority such
+// as "10:kubernetes/**/overlays/*", and the match mode.
+func newGrouping(patterns []string, match string) (grouping, error) {
+	var g grouping
+	switch match {
+	case "", MatchShortest:
+	case MatchLongest:
+		g.longest = true
+	default:
+		return grouping{}, fmt.Errorf("invalid group-by match mode: %q (expected %s or %s)", match, MatchShortest, MatchLongest)
+	}
+
+	for _, text := range patterns {
+		pattern, priority := text, 0
+		if prefix, rest, ok := strings.Cut(text, ":"); ok {
+			if n, err := strconv.Atoi(prefix); err == nil {
+				pattern, priority = rest, n
+			}
+		}
+		p, err := newGroupPattern(pattern, priority)
+		if err != nil {
+			return grouping{}, err
+		}
+		g.patterns = append(g.patterns, p)
+	}
+	return g, nil
+}
+
+// setDepth makes g group changes by their ancestor depth components below
+// from, or below the repository root if from is empty.
+func (g *grouping) setDepth(depth int, from string) error {
+	switch {
+	case depth < 0:
+		return fmt.Errorf("invalid depth: %d", depth)
+	case depth == 0 && from != "":
+		return fmt.Errorf("depth-from %q requires depth", from)
+	case depth > 0 && len(g.patterns) > 0:
+		return fmt.Errorf("depth cannot be used with group-by patterns")
+	}
+	g.depth = depth
+	g.depthFrom = strings.Trim(filepath.ToSlash(filepath.Clean(from)), "/")
+	if g.depthFrom == "." {
+		g.depthFrom = ""
+	}
+	return nil
+}
+
+// dirAtDepth returns the ancestor of dir at the depth of g, or dir itself if
+// it is shallower or not under depthFrom.
+func (g grouping) dirAtDepth(dir string) (string, bool) {
+	if dir == "." {
+		return dir, false
+	}
+	parts := strings.Split(dir, "/")
+	n := g.depth
+	if g.depthFrom != "" {
+		if !matchArgs([]string{g.depthFrom}, dir) {
+			return dir, false
+		}
+		n += len(strings.Split(g.depthFrom, "/"))
+	}
+	if len(parts) <= n {
+		return dir, false
+	}
+	return strings.Join(parts[:n], "/"), true
+}
+
+// lookup returns the pattern dir was grouped by, that is the first of the
+// highest priority matching dir.
+func (g grouping) lookup(dir string) (groupPattern, bool) {
+	var found groupPattern
+	ok := false
+	for _, p := range g.patterns {
+		if matched, _ := doublestar.Match(p.pattern, dir); !matched {
+			continue
+		}
+		if !ok || p.priority > found.priority {
+			found, ok = p, true
+		}
+	}
+	return found, ok
+}
+
+func (g grouping) mode() string {
+	if g.longest {
+		return MatchLongest
+	}
+	return MatchShortest
+}
+
+// candidate is an ancestor of a change matched by a group-by pattern.
+type candidate struct {
+	dir      string
+	depth    int
+	priority int
+}
+
+// better reports whether c should be preferred over other.
+func (g grouping) better(c, other candidate) bool {
+	if c.priority != other.priority {
+		return c.priority > other.priority
+	}
+	if g.longest {
+		return c.depth > other.depth
+	}
+	return c.depth < other.depth
+}
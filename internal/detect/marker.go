@@ -0,0 +1,115 @@
+package detect
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// rootMarker is a --root-marker, a glob pattern of file names optionally
+// followed by a regular expression the file content has to match, such as
+// "*.tf:backend\s+\"".
+type rootMarker struct {
+	text    string
+	pattern string
+	content *regexp.Regexp
+}
+
+func (m rootMarker) String() string {
+	return m.text
+}
+
+func newRootMarker(text string) (rootMarker, error) {
+	m := rootMarker{text: text, pattern: text}
+	if pattern, expr, ok := strings.Cut(text, ":"); ok {
+		re, err := regexp.Compile("(?m)" + expr)
+		if err != nil {
+			return rootMarker{}, fmt.Errorf("bad root marker %q: %w", text, err)
+		}
+		m.pattern, m.content = pattern, re
+	}
+	if m.pattern == "" || !doublestar.ValidatePattern(m.pattern) {
+		return rootMarker{}, fmt.Errorf("bad root marker %q", text)
+	}
+	return m, nil
+}
+
+// ValidateRootMarker reports an error if marker is not a valid root marker.
+func ValidateRootMarker(marker string) error {
+	_, err := newRootMarker(marker)
+	return err
+}
+
+// matches reports whether the file at path named name in fsys is a marker.
+func (m rootMarker) matches(fsys fileSystem, path, name string) bool {
+	if matched, _ := doublestar.Match(m.pattern, name); !matched {
+		return false
+	}
+	if m.content == nil {
+		return true
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return m.content.Match(data)
+}
+
+// ValidateRootMarkerCeiling reports an error if ceiling, relative to the
+// repository root, is above the root, where no dir could be under it.
+func ValidateRootMarkerCeiling(ceiling string) error {
+	rel := filepath.Clean(ceiling)
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("root-marker ceiling %q is outside the repository", ceiling)
+	}
+	return nil
+}
+
+// markerSteps returns dir and its ancestors up to ceiling, which defaults to
+// ".", the repository root. ceiling itself is included. dir and ceiling are
+// both relative to the repository root, so that the steps do not depend on
+// the current directory. maxDepth limits the number of directories returned
+// if not zero. Nothing is returned if dir is not under ceiling.
+func markerSteps(dir, ceiling string, maxDepth int) []string {
+	if ceiling == "" {
+		ceiling = "."
+	}
+	rel, err := filepath.Rel(filepath.Clean(ceiling), filepath.Clean(dir))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+
+	var steps []string
+	step := filepath.Clean(dir)
+	for {
+		steps = append(steps, step)
+		if rel == "." || (maxDepth > 0 && len(steps) >= maxDepth) {
+			break
+		}
+		step, rel = filepath.Dir(step), filepath.Dir(rel)
+	}
+	return steps
+}
+
+// findRootByMarker returns the nearest directory of steps containing a
+// marker file in fsys, and the marker found. The markers are tried in order,
+// so that an earlier marker wins over a later one found nearer.
+func findRootByMarker(fsys fileSystem, steps []string, markers []rootMarker) (string, rootMarker) {
+	for _, marker := range markers {
+		for _, step := range steps {
+			names, err := fsys.ListFiles(step)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				if marker.matches(fsys, filepath.Join(step, name), name) {
+					return step, marker
+				}
+			}
+		}
+	}
+	return "", rootMarker{}
+}
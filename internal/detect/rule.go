@@ -0,0 +1,169 @@
+package detect
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/babarot/changed-objects/internal/git"
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/samber/lo"
+)
+
+// IgnoreFileName is the name of the gitignore-style file listing the
+// changes to skip.
+const IgnoreFileName = ".changedignore"
+
+// rule is a gitignore-style ignore pattern along with where it was
+// defined. It only applies to the changes of the given types, or to all of
+// them if types is empty.
+type rule struct {
+	text    string
+	source  string
+	types   []git.Type
+	pattern gitignore.Pattern
+}
+
+func (r rule) String() string {
+	return fmt.Sprintf("%q (%s)", r.text, r.source)
+}
+
+func newRule(text, source string) (rule, error) {
+	types, pattern, err := splitTypes(text)
+	if err != nil {
+		return rule{}, fmt.Errorf("%s: %w", source, err)
+	}
+	return rule{
+		text:    text,
+		source:  source,
+		types:   types,
+		pattern: gitignore.ParsePattern(pattern, nil),
+	}, nil
+}
+
+// include is a doublestar pattern matched against whole file paths. Like
+// rule, it only applies to the changes of the given types.
+type include struct {
+	text    string
+	types   []git.Type
+	pattern string
+}
+
+func newInclude(text string) (include, error) {
+	types, pattern, err := splitTypes(text)
+	if err != nil {
+		return include{}, err
+	}
+	if !doublestar.ValidatePattern(pattern) {
+		return include{}, fmt.Errorf("bad include pattern: %q", text)
+	}
+	return include{text: text, types: types, pattern: pattern}, nil
+}
+
+// splitTypes splits a pattern with an optional change type prefix such as
+// "deleted:archive/**" or "added,modified:src/**". A prefix which is not a
+// list of type names is part of the pattern.
+func splitTypes(text string) ([]git.Type, string, error) {
+	prefix, pattern, ok := strings.Cut(text, ":")
+	if !ok {
+		return nil, text, nil
+	}
+	var types []git.Type
+	for _, name := range strings.Split(prefix, ",") {
+		name = strings.TrimSpace(name)
+		ty, err := git.ParseType(name)
+		if err != nil || ty.String() != name {
+			// not a type prefix: a colon in the pattern itself
+			return nil, text, nil
+		}
+		types = append(types, ty)
+	}
+	if pattern == "" {
+		return nil, "", fmt.Errorf("empty pattern: %q", text)
+	}
+	return types, pattern, nil
+}
+
+// ValidatePattern reports an error if pattern, which may have a change type
+// prefix and a leading !, is not a valid glob pattern.
+func ValidatePattern(pattern string) error {
+	_, p, err := splitTypes(pattern)
+	if err != nil {
+		return err
+	}
+	if !doublestar.ValidatePattern(strings.TrimPrefix(p, "!")) {
+		return fmt.Errorf("bad glob pattern %q", pattern)
+	}
+	return nil
+}
+
+// appliesTo reports whether a pattern restricted to types applies to a
+// change of type ty.
+func appliesTo(types []git.Type, ty git.Type) bool {
+	return len(types) == 0 || lo.Contains(types, ty)
+}
+
+// readIgnoreFile reads rules from a gitignore-style file. Blank lines and
+// lines starting with # are skipped.
+func readIgnoreFile(path string) ([]rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []rule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		r, err := newRule(line, fmt.Sprintf("%s:%d", path, n))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// matchRules returns the rule deciding whether change is ignored, that is
+// the last matching one as in gitignore, and whether it ignores change. A
+// rule starting with ! re-includes what previous rules ignored.
+func matchRules(rules []rule, change git.Change) (rule, bool) {
+	parts := strings.Split(change.Path, "/")
+	for i := len(rules) - 1; i >= 0; i-- {
+		if !appliesTo(rules[i].types, change.Type) {
+			continue
+		}
+		switch rules[i].pattern.Match(parts, false) {
+		case gitignore.Exclude:
+			return rules[i], true
+		case gitignore.Include:
+			return rules[i], false
+		}
+	}
+	return rule{}, false
+}
+
+// matchIncludes returns the first of includes matching change.
+func matchIncludes(includes []include, change git.Change) (include, bool) {
+	for _, include := range includes {
+		if !appliesTo(include.types, change.Type) {
+			continue
+		}
+		if matched, _ := doublestar.Match(include.pattern, change.Path); matched {
+			return include, true
+		}
+	}
+	return include{}, false
+}
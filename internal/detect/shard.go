@@ -0,0 +1,164 @@
+package detect
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/babarot/changed-objects/internal/git"
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// shardWeight is the weight of the dirs matching a glob pattern, written as
+// <pattern>=<weight>.
+type shardWeight struct {
+	pattern string
+	weight  int
+}
+
+func newShardWeight(text string) (shardWeight, error) {
+	i := strings.LastIndex(text, "=")
+	if i < 0 {
+		return shardWeight{}, fmt.Errorf("bad shard weight %q: expected <pattern>=<weight>", text)
+	}
+	pattern := text[:i]
+	if pattern == "" || !doublestar.ValidatePattern(pattern) {
+		return shardWeight{}, fmt.Errorf("bad glob pattern in shard weight %q", text)
+	}
+	weight, err := strconv.Atoi(text[i+1:])
+	if err != nil || weight < 1 {
+		return shardWeight{}, fmt.Errorf("bad shard weight %q: weight must be a positive integer", text)
+	}
+	return shardWeight{pattern: pattern, weight: weight}, nil
+}
+
+// ValidateShardWeight reports an error if text is not a valid
+// <pattern>=<weight> shard weight.
+func ValidateShardWeight(text string) error {
+	_, err := newShardWeight(text)
+	return err
+}
+
+// sharding partitions dirs into n buckets balanced by their weights.
+type sharding struct {
+	n       int
+	index   *int
+	weights []shardWeight
+}
+
+func newSharding(n int, index *int, weights []string) (sharding, error) {
+	if n < 0 {
+		return sharding{}, fmt.Errorf("invalid number of shards: %d", n)
+	}
+	if n == 0 && (index != nil || len(weights) > 0) {
+		return sharding{}, fmt.Errorf("shard index and shard weights require the number of shards")
+	}
+	if index != nil && (*index < 0 || *index >= n) {
+		return sharding{}, fmt.Errorf("invalid shard index: %d (expected 0 to %d)", *index, n-1)
+	}
+	s := sharding{n: n, index: index}
+	for _, text := range weights {
+		w, err := newShardWeight(text)
+		if err != nil {
+			return sharding{}, err
+		}
+		s.weights = append(s.weights, w)
+	}
+	return s, nil
+}
+
+// weight returns the weight of the first shard weight pattern matching dir,
+// or the number of its files.
+func (s sharding) weight(dir Dir) int {
+	for _, w := range s.weights {
+		if ok, _ := doublestar.Match(w.pattern, dir.Path); ok {
+			return w.weight
+		}
+	}
+	return max(len(dir.Files), 1)
+}
+
+// assign sets the shard of each dir. The heaviest dirs are assigned first,
+// each to the lightest shard so far, and ties are ordered by a hash of the
+// path so that the same dirs always get the same shards.
+func (s sharding) assign(dirs []Dir) {
+	type item struct {
+		i      int
+		weight int
+		hash   uint32
+	}
+	items := make([]item, len(dirs))
+	for i, dir := range dirs {
+		h := fnv.New32a()
+		h.Write([]byte(dir.Path))
+		items[i] = item{i: i, weight: s.weight(dir), hash: h.Sum32()}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.weight != b.weight {
+			return a.weight > b.weight
+		}
+		if a.hash != b.hash {
+			return a.hash < b.hash
+		}
+		return dirs[a.i].Path < dirs[b.i].Path
+	})
+
+	loads := make([]int, s.n)
+	for _, item := range items {
+		shard := 0
+		for i := range loads {
+			if loads[i] < loads[shard] {
+				shard = i
+			}
+		}
+		loads[shard] += item.weight
+		dirs[item.i].Shard = &shard
+	}
+}
+
+// apply assigns shards to dirs and, if a shard index is given, keeps only
+// the dirs in that shard and their files.
+func (s sharding) apply(files []File, dirs []Dir, rec *recorder) ([]File, []Dir) {
+	if s.n == 0 {
+		return files, dirs
+	}
+	s.assign(dirs)
+	if s.index == nil {
+		return files, dirs
+	}
+
+	var kept []Dir
+	paths := make(map[string]bool)
+	for _, dir := range dirs {
+		ok := *dir.Shard == *s.index
+		for _, file := range dir.Files {
+			change := git.Change{Path: file.Path, Type: file.Type}
+			rec.filter(change, "shard", ok, "%q is in shard %d of %d, wanted: %d", dir.Path, *dir.Shard, s.n, *s.index)
+			if !ok {
+				rec.exclude(change)
+				continue
+			}
+			paths[file.Path] = true
+		}
+		if ok {
+			kept = append(kept, dir)
+		}
+	}
+
+	var keptFiles []File
+	for _, file := range files {
+		if paths[file.Path] {
+			keptFiles = append(keptFiles, file)
+		}
+	}
+	if keptFiles == nil {
+		keptFiles = []File{}
+	}
+	if kept == nil {
+		kept = []Dir{}
+	}
+	return keptFiles, kept
+}
@@ -0,0 +1,120 @@
+package detect
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/babarot/changed-objects/internal/git"
+	"github.com/samber/lo"
+)
+
+const (
+	SortPath    = "path"
+	SortType    = "type"
+	SortSize    = "size"
+	SortChanges = "changes"
+)
+
+func validateSort(key string) error {
+	switch key {
+	case "", SortPath, SortType, SortSize, SortChanges:
+		return nil
+	}
+	return fmt.Errorf("invalid sort key: %q (expected %s, %s, %s or %s)", key, SortPath, SortType, SortSize, SortChanges)
+}
+
+// sortKey is what files and dirs are ordered by: the largest size or number
+// of changes first, then the type of change, then the path.
+type sortKey struct {
+	n    int64
+	ty   git.Type
+	path string
+}
+
+func (k sortKey) less(other sortKey) bool {
+	if k.n != other.n {
+		return k.n > other.n
+	}
+	if k.ty != other.ty {
+		return k.ty < other.ty
+	}
+	return k.path < other.path
+}
+
+// keyed sorts items by their keys.
+type keyed[T any] struct {
+	items   []T
+	keys    []sortKey
+	reverse bool
+}
+
+func (k keyed[T]) Len() int { return len(k.items) }
+
+func (k keyed[T]) Swap(i, j int) {
+	k.items[i], k.items[j] = k.items[j], k.items[i]
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+}
+
+func (k keyed[T]) Less(i, j int) bool {
+	if k.reverse {
+		return k.keys[j].less(k.keys[i])
+	}
+	return k.keys[i].less(k.keys[j])
+}
+
+// sorter orders files and dirs by key, breaking ties by path. Sizes are
+// taken from fsys.
+type sorter struct {
+	key     string
+	reverse bool
+	fsys    fileSystem
+}
+
+func (s sorter) fileKey(file File) sortKey {
+	k := sortKey{path: file.Path}
+	switch s.key {
+	case SortSize:
+		k.n = s.fsys.Size(file.Path)
+	case SortType:
+		k.ty = file.Type
+	}
+	return k
+}
+
+func (s sorter) dirKey(dir Dir) sortKey {
+	k := sortKey{path: dir.Path}
+	switch s.key {
+	case SortSize:
+		k.n = lo.SumBy(dir.Files, func(file File) int64 {
+			return s.fsys.Size(file.Path)
+		})
+	case SortChanges:
+		k.n = int64(len(dir.Files))
+	case SortType:
+		// the dirs having the first type of change come first, e.g.
+		// additions before deletions
+		k.ty = lo.MinBy(dir.Files, func(a, b File) bool {
+			return a.Type < b.Type
+		}).Type
+	}
+	return k
+}
+
+func (s sorter) files(files []File) {
+	sort.Sort(keyed[File]{
+		items:   files,
+		keys:    lo.Map(files, func(file File, _ int) sortKey { return s.fileKey(file) }),
+		reverse: s.reverse,
+	})
+}
+
+func (s sorter) dirs(dirs []Dir) {
+	for _, dir := range dirs {
+		s.files(dir.Files)
+	}
+	sort.Sort(keyed[Dir]{
+		items:   dirs,
+		keys:    lo.Map(dirs, func(dir Dir, _ int) sortKey { return s.dirKey(dir) }),
+		reverse: s.reverse,
+	})
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/utils/merkletrie"
 )
 
@@ -25,16 +27,59 @@ type Change struct {
 	Type Type
 }
 
-func Open(cfg Config) ([]Change, error) {
+// PhaseError reports the phase of the comparison that was running when
+// the context was canceled or its deadline exceeded.
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return fmt.Sprintf("timed out while %s", e.Phase)
+	}
+	return fmt.Sprintf("canceled while %s: %v", e.Phase, e.Err)
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// InPhase wraps err in a PhaseError if it was caused by ctx, and returns it
+// unchanged otherwise.
+func InPhase(ctx context.Context, phase string, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	var pe *PhaseError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &PhaseError{Phase: phase, Err: ctx.Err()}
+}
+
+// Comparison is the changes between the base commit and the target commit,
+// along with the trees of the commits.
+type Comparison struct {
+	Changes []Change
+	Base    *Tree
+	// Target is the tree of the target commit, which is HEAD.
+	Target *Tree
+}
+
+func Open(ctx context.Context, cfg Config) (Comparison, error) {
+	if err := ctx.Err(); err != nil {
+		return Comparison{}, InPhase(ctx, "opening repository", err)
+	}
 	repo, err := git.PlainOpen(cfg.Path)
 	if err != nil {
-		return []Change{}, fmt.Errorf("cannot open repository: %w", err)
+		return Comparison{}, fmt.Errorf("cannot open repository: %w", err)
 	}
 	cfg.repo = repo
 
-	currentBranch, err := cfg.getCurrentBranch()
+	currentBranch, err := cfg.getCurrentBranch(ctx)
 	if err != nil {
-		return []Change{}, err
+		return Comparison{}, InPhase(ctx, "resolving current branch", err)
 	}
 	log.Printf("[TRACE] Getting current branch: %s", currentBranch)
 
@@ -45,14 +90,14 @@ func Open(cfg Config) ([]Change, error) {
 		log.Printf("[DEBUG] Getting previous HEAD commit")
 		prev, err := cfg.previousCommit()
 		if err != nil {
-			return []Change{}, err
+			return Comparison{}, err
 		}
 		base = prev
 	default:
 		log.Printf("[DEBUG] Getting remote commit")
-		remote, err := cfg.remoteCommit("origin/" + cfg.DefaultBranch)
+		remote, err := cfg.remoteCommit(ctx, "origin/"+cfg.DefaultBranch)
 		if err != nil {
-			return []Change{}, err
+			return Comparison{}, InPhase(ctx, "resolving default branch", err)
 		}
 		base = remote
 	}
@@ -60,12 +105,12 @@ func Open(cfg Config) ([]Change, error) {
 	if base == nil {
 		defaultBranch, err := cfg.getDefaultBranch()
 		if err != nil {
-			return []Change{}, fmt.Errorf("%w: default branch %s is not wrong", err, cfg.DefaultBranch)
+			return Comparison{}, fmt.Errorf("%w: default branch %s is not wrong", err, cfg.DefaultBranch)
 		}
 		log.Printf("[DEBUG] base is nil. So get remote commit from %q", defaultBranch)
-		remote, err := cfg.remoteCommit(defaultBranch)
+		remote, err := cfg.remoteCommit(ctx, defaultBranch)
 		if err != nil {
-			return []Change{}, err
+			return Comparison{}, InPhase(ctx, "resolving default branch", err)
 		}
 		base = remote
 	}
@@ -74,12 +119,12 @@ func Open(cfg Config) ([]Change, error) {
 		log.Printf("[DEBUG] Comparing with merge-base")
 		h, err := cfg.repo.Head()
 		if err != nil {
-			return []Change{}, err
+			return Comparison{}, err
 		}
 		currentBranch := h.Name().Short()
-		mb, err := cfg.mergeBaseCommit(cfg.MergeBase, currentBranch)
+		mb, err := cfg.mergeBaseCommit(ctx, cfg.MergeBase, currentBranch)
 		if err != nil {
-			return []Change{}, err
+			return Comparison{}, InPhase(ctx, "computing merge-base", err)
 		}
 		if mb != nil {
 			base = mb
@@ -89,14 +134,31 @@ func Open(cfg Config) ([]Change, error) {
 	log.Printf("[DEBUG] Getting current commit")
 	current, err := cfg.currentCommit()
 	if err != nil {
-		return []Change{}, err
+		return Comparison{}, err
+	}
+
+	changes, err := cfg.getChanges(ctx, base, current)
+	if err != nil {
+		return Comparison{}, InPhase(ctx, "comparing trees", err)
 	}
 
-	return cfg.getChanges(base, current)
+	baseTree, err := newTree(base)
+	if err != nil {
+		return Comparison{}, err
+	}
+	targetTree, err := newTree(current)
+	if err != nil {
+		return Comparison{}, err
+	}
+	return Comparison{
+		Changes: changes,
+		Base:    baseTree,
+		Target:  targetTree,
+	}, nil
 }
 
 // https://github.com/src-d/go-git/issues/1030
-func (c Config) getCurrentBranch() (string, error) {
+func (c Config) getCurrentBranch(ctx context.Context) (string, error) {
 	branchRefs, err := c.repo.Branches()
 	if err != nil {
 		return "", err
@@ -109,6 +171,9 @@ func (c Config) getCurrentBranch() (string, error) {
 
 	var currentBranchName string
 	err = branchRefs.ForEach(func(branchRef *plumbing.Reference) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if branchRef.Hash() == headRef.Hash() {
 			currentBranchName = branchRef.Name().Short()
 			return nil
@@ -142,7 +207,7 @@ func (c Config) previousCommit() (*object.Commit, error) {
 	return c.repo.CommitObject(*hash)
 }
 
-func (c Config) remoteCommit(name string) (*object.Commit, error) {
+func (c Config) remoteCommit(ctx context.Context, name string) (*object.Commit, error) {
 	refs, err := c.repo.References()
 	if err != nil {
 		return nil, err
@@ -150,6 +215,9 @@ func (c Config) remoteCommit(name string) (*object.Commit, error) {
 
 	var cmt *object.Commit
 	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if ref.Name().String() == fmt.Sprintf("refs/remotes/%s", name) {
 			commit, err := c.repo.CommitObject(ref.Hash())
 			if err != nil {
@@ -168,7 +236,7 @@ func (c Config) remoteCommit(name string) (*object.Commit, error) {
 }
 
 // https://github.com/go-git/go-git/blob/master/_examples/merge_base/main.go
-func (c Config) mergeBaseCommit(baseRev, commitRev string) (*object.Commit, error) {
+func (c Config) mergeBaseCommit(ctx context.Context, baseRev, commitRev string) (*object.Commit, error) {
 	log.Printf("[DEBUG] baseRev: %s, commitRev: %s", baseRev, commitRev)
 
 	// Get the hashes of the passed revisions
@@ -191,7 +259,7 @@ func (c Config) mergeBaseCommit(baseRev, commitRev string) (*object.Commit, erro
 		commits = append(commits, commit)
 	}
 
-	res, err := commits[0].MergeBase(commits[1])
+	res, err := mergeBase(ctx, commits[0], commits[1])
 	if err != nil {
 		return nil, err
 	}
@@ -203,6 +271,64 @@ func (c Config) mergeBaseCommit(baseRev, commitRev string) (*object.Commit, erro
 	return res[0], nil
 }
 
+// mergeBase is (*object.Commit).MergeBase which gives up walking the
+// histories once ctx is done.
+func mergeBase(ctx context.Context, a, b *object.Commit) ([]*object.Commit, error) {
+	if a.Hash == b.Hash {
+		return []*object.Commit{a}, nil
+	}
+
+	// index the history of the newer commit and walk the older one until
+	// reaching it, the same strategy go-git uses
+	newer, older := a, b
+	if older.Committer.When.After(newer.Committer.When) {
+		newer, older = older, newer
+	}
+
+	history := map[plumbing.Hash]struct{}{}
+	err := object.NewCommitIterBSF(newer, nil, nil).ForEach(func(commit *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if commit.Hash == older.Hash {
+			history = nil
+			return storer.ErrStop
+		}
+		history[commit.Hash] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		// older is reachable from newer
+		return []*object.Commit{older}, nil
+	}
+
+	inHistory := object.CommitFilter(func(commit *object.Commit) bool {
+		_, ok := history[commit.Hash]
+		return ok
+	})
+	isLimit := object.CommitFilter(func(commit *object.Commit) bool {
+		// stop traversing as soon as ctx is done
+		return ctx.Err() != nil || inHistory(commit)
+	})
+
+	var res []*object.Commit
+	err = object.NewFilterCommitIter(older, &inHistory, &isLimit).ForEach(func(commit *object.Commit) error {
+		res = append(res, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return object.Independents(res)
+}
+
 type Type int
 
 const (
@@ -229,7 +355,34 @@ func (t Type) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.String())
 }
 
-func (c Config) getChanges(from, to *object.Commit) ([]Change, error) {
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	ty, err := ParseType(s)
+	if err != nil {
+		return err
+	}
+	*t = ty
+	return nil
+}
+
+// ParseType converts a type name such as "added" (or its name-status
+// letter "A") into Type.
+func ParseType(s string) (Type, error) {
+	switch s {
+	case "added", "A":
+		return Addition, nil
+	case "deleted", "D":
+		return Deletion, nil
+	case "modified", "M":
+		return Modification, nil
+	}
+	return Unknown, fmt.Errorf("unknown change type: %q", s)
+}
+
+func (c Config) getChanges(ctx context.Context, from, to *object.Commit) ([]Change, error) {
 	log.Printf("[TRACE] git.getChanges: from %#v, to %#v\n", from, to)
 
 	src, err := to.Tree()
@@ -242,7 +395,7 @@ func (c Config) getChanges(from, to *object.Commit) ([]Change, error) {
 		return []Change{}, err
 	}
 
-	changes, err := object.DiffTree(dst, src)
+	changes, err := object.DiffTreeWithOptions(ctx, dst, src, nil)
 	if err != nil {
 		return []Change{}, err
 	}
@@ -0,0 +1,109 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// newHistory creates the following history and returns its commits:
+//
+//	A---B---C  main
+//	     \
+//	      D---E  topic
+func newHistory(t *testing.T) map[string]*object.Commit {
+	t.Helper()
+
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(msg string) *object.Commit {
+		when = when.Add(time.Minute)
+		hash, err := wt.Commit(msg, &git.CommitOptions{
+			AllowEmptyCommits: true,
+			Author:            &object.Signature{Name: "test", Email: "test@example.com", When: when},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := repo.CommitObject(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	commits := map[string]*object.Commit{}
+	commits["A"] = commit("A")
+	commits["B"] = commit("B")
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("topic"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commits["D"] = commit("D")
+	commits["E"] = commit("E")
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}); err != nil {
+		t.Fatal(err)
+	}
+	commits["C"] = commit("C")
+	return commits
+}
+
+func Test_mergeBase(t *testing.T) {
+	commits := newHistory(t)
+
+	cases := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "diverged branches", a: "C", b: "E", want: "B"},
+		{name: "reversed order", a: "E", b: "C", want: "B"},
+		{name: "ancestor", a: "A", b: "E", want: "A"},
+		{name: "same commit", a: "C", b: "C", want: "C"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeBase(context.Background(), commits[tt.a], commits[tt.b])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Hash != commits[tt.want].Hash {
+				t.Errorf("mergeBase(%s, %s) = %v, want %s", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeBase_Canceled(t *testing.T) {
+	commits := newHistory(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := mergeBase(ctx, commits["C"], commits["E"])
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("mergeBase should fail with context.Canceled, got %v", err)
+	}
+
+	err = InPhase(ctx, "computing merge-base", err)
+	var pe *PhaseError
+	if !errors.As(err, &pe) || pe.Phase != "computing merge-base" {
+		t.Errorf("InPhase should return a PhaseError, got %#v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// statusRe matches a status column produced by `git diff --name-status`,
+// e.g. "M", "A", "D", "T", "R100" or "C075".
+var statusRe = regexp.MustCompile(`^([ACDMRTUXB])[0-9]*$`)
+
+// ParseChanges reads a list of changes from r. The following formats are
+// detected automatically:
+//
+//   - JSON array of objects such as [{"path":"a/b.tf","type":"added"}]
+//   - output of `git diff --name-status` (with or without -z)
+//   - plain path lists, one path per line or NUL-separated
+//
+// Paths given without a status are treated as modified.
+func ParseChanges(r io.Reader) ([]Change, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return []Change{}, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return []Change{}, nil
+	case trimmed[0] == '[':
+		return parseJSON(trimmed)
+	case bytes.IndexByte(data, 0) >= 0:
+		return parseFields(strings.Split(strings.TrimRight(string(data), "\x00\n"), "\x00"))
+	default:
+		return parseLines(data)
+	}
+}
+
+func parseJSON(data []byte) ([]Change, error) {
+	var items []struct {
+		Path string `json:"path"`
+		// nil if the item has no type
+		Type *Type `json:"type"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return []Change{}, fmt.Errorf("cannot parse changes as JSON: %w", err)
+	}
+
+	cs := []Change{}
+	for i, item := range items {
+		if item.Path == "" {
+			return []Change{}, fmt.Errorf("cannot parse changes as JSON: item %d has no path", i)
+		}
+		ty := Modification
+		if item.Type != nil {
+			ty = *item.Type
+		}
+		cs = append(cs, Change{Path: item.Path, Type: ty})
+	}
+	return cs, nil
+}
+
+// parseFields parses NUL-separated output, i.e. `git diff --name-status -z`
+// or `git diff --name-only -z`.
+func parseFields(fields []string) ([]Change, error) {
+	cs := []Change{}
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if !statusRe.MatchString(status) {
+			// no status column: plain path list
+			cs = append(cs, Change{Path: status, Type: Modification})
+			continue
+		}
+		n := 1
+		if status[0] == 'R' || status[0] == 'C' {
+			n = 2
+		}
+		if i+n >= len(fields) {
+			return []Change{}, fmt.Errorf("cannot parse changes: status %q has no path", status)
+		}
+		cs = append(cs, statusChanges(status, fields[i+1:i+1+n])...)
+		i += n
+	}
+	return cs, nil
+}
+
+// parseLines parses line-oriented output, i.e. `git diff --name-status`
+// or a plain path list.
+func parseLines(data []byte) ([]Change, error) {
+	cs := []Change{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || !statusRe.MatchString(fields[0]) {
+			cs = append(cs, Change{Path: line, Type: Modification})
+			continue
+		}
+		cs = append(cs, statusChanges(fields[0], fields[1:])...)
+	}
+	if err := scanner.Err(); err != nil {
+		return []Change{}, err
+	}
+	return cs, nil
+}
+
+// statusChanges converts a single name-status entry into changes. Renames
+// are reported as a deletion of the old path and an addition of the new
+// one, which is how go-git reports them when comparing trees.
+func statusChanges(status string, paths []string) []Change {
+	switch status[0] {
+	case 'A':
+		return []Change{{Path: paths[0], Type: Addition}}
+	case 'D':
+		return []Change{{Path: paths[0], Type: Deletion}}
+	case 'M', 'T', 'U':
+		return []Change{{Path: paths[0], Type: Modification}}
+	case 'R':
+		if len(paths) < 2 {
+			return []Change{{Path: paths[0], Type: Addition}}
+		}
+		return []Change{
+			{Path: paths[0], Type: Deletion},
+			{Path: paths[1], Type: Addition},
+		}
+	case 'C':
+		return []Change{{Path: paths[len(paths)-1], Type: Addition}}
+	default:
+		return []Change{{Path: paths[0], Type: Unknown}}
+	}
+}
@@ -0,0 +1,117 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseChanges(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []Change
+	}{
+		{
+			name:  "empty input",
+			input: "\n",
+			want:  []Change{},
+		},
+		{
+			name:  "name-status",
+			input: "A\tterraform/a/main.tf\nM\tterraform/b/main.tf\nD\tterraform/c/main.tf\n",
+			want: []Change{
+				{Path: "terraform/a/main.tf", Type: Addition},
+				{Path: "terraform/b/main.tf", Type: Modification},
+				{Path: "terraform/c/main.tf", Type: Deletion},
+			},
+		},
+		{
+			name:  "name-status with rename and copy",
+			input: "R100\told/main.tf\tnew/main.tf\nC075\tsrc/a.go\tsrc/b.go\n",
+			want: []Change{
+				{Path: "old/main.tf", Type: Deletion},
+				{Path: "new/main.tf", Type: Addition},
+				{Path: "src/b.go", Type: Addition},
+			},
+		},
+		{
+			name:  "name-status -z",
+			input: "M\x00dir with space/a.tf\x00R090\x00x/a.tf\x00y/a.tf\x00D\x00z/a.tf\x00",
+			want: []Change{
+				{Path: "dir with space/a.tf", Type: Modification},
+				{Path: "x/a.tf", Type: Deletion},
+				{Path: "y/a.tf", Type: Addition},
+				{Path: "z/a.tf", Type: Deletion},
+			},
+		},
+		{
+			name:  "plain path list",
+			input: "terraform/a/main.tf\r\nterraform/b/main.tf\r\n",
+			want: []Change{
+				{Path: "terraform/a/main.tf", Type: Modification},
+				{Path: "terraform/b/main.tf", Type: Modification},
+			},
+		},
+		{
+			name:  "NUL-separated path list",
+			input: "terraform/a/main.tf\x00terraform/b/main.tf\x00",
+			want: []Change{
+				{Path: "terraform/a/main.tf", Type: Modification},
+				{Path: "terraform/b/main.tf", Type: Modification},
+			},
+		},
+		{
+			name:  "JSON array",
+			input: `[{"path":"a/main.tf","type":"added"},{"path":"b/main.tf","type":"deleted"}]`,
+			want: []Change{
+				{Path: "a/main.tf", Type: Addition},
+				{Path: "b/main.tf", Type: Deletion},
+			},
+		},
+		{
+			name:  "JSON items without type",
+			input: `[{"path":"a/main.tf"},{"path":"b/main.tf","type":null}]`,
+			want: []Change{
+				{Path: "a/main.tf", Type: Modification},
+				{Path: "b/main.tf", Type: Modification},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseChanges(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseChanges_Error(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{name: "unknown JSON type", input: `[{"path":"a.tf","type":"renamed"}]`},
+		{name: "JSON item without path", input: `[{"type":"added"}]`},
+		{name: "status without path", input: "M\x00"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := ParseChanges(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("ParseChanges(%q) should return an error", tt.input)
+			}
+		})
+	}
+}
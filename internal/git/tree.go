@@ -0,0 +1,92 @@
+package git
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Tree is the snapshot of the repository at a commit, used to look up files
+// which may not be in the working tree, e.g. deleted ones. Paths are relative
+// to the repository root. A nil Tree has no files.
+type Tree struct {
+	tree *object.Tree
+}
+
+func newTree(commit *object.Commit) (*Tree, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{tree: tree}, nil
+}
+
+func (t *Tree) subtree(dir string) (*object.Tree, error) {
+	if t == nil {
+		return nil, fs.ErrNotExist
+	}
+	dir = path.Clean(filepath.ToSlash(dir))
+	if dir == "." {
+		return t.tree, nil
+	}
+	return t.tree.Tree(dir)
+}
+
+// ListFiles returns the names of the files in dir, not including
+// directories.
+func (t *Tree) ListFiles(dir string) ([]string, error) {
+	tree, err := t.subtree(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range tree.Entries {
+		if entry.Mode.IsFile() {
+			names = append(names, entry.Name)
+		}
+	}
+	return names, nil
+}
+
+// ReadFile returns the content of the file at path.
+func (t *Tree) ReadFile(name string) ([]byte, error) {
+	if t == nil {
+		return nil, fs.ErrNotExist
+	}
+	file, err := t.tree.File(path.Clean(filepath.ToSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// Exists reports whether a file or a directory exists at path.
+func (t *Tree) Exists(name string) bool {
+	if t == nil {
+		return false
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	if name == "." {
+		return true
+	}
+	_, err := t.tree.FindEntry(name)
+	return err == nil
+}
+
+// Size returns the size of the file at path, or 0 if there is none.
+func (t *Tree) Size(name string) int64 {
+	if t == nil {
+		return 0
+	}
+	file, err := t.tree.File(path.Clean(filepath.ToSlash(name)))
+	if err != nil {
+		return 0
+	}
+	return file.Size
+}
@@ -0,0 +1,87 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTree(t *testing.T) {
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"README.md":            "readme",
+		"stacks/a/main.tf":     "terraform {}",
+		"stacks/a/vars.tf":     "",
+		"stacks/a/env/prod.tf": "",
+	} {
+		if err := util.WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wt.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := newTree(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := tree.ListFiles("stacks/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(files, []string{"main.tf", "vars.tf"}); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+
+	content, err := tree.ReadFile("stacks/a/main.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "terraform {}" {
+		t.Errorf("ReadFile = %q, want %q", content, "terraform {}")
+	}
+
+	for path, want := range map[string]bool{
+		".":                true,
+		"stacks":           true,
+		"stacks/a/main.tf": true,
+		"stacks/b":         false,
+	} {
+		if got := tree.Exists(path); got != want {
+			t.Errorf("Exists(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	var nilTree *Tree
+	if _, err := nilTree.ListFiles("."); err == nil {
+		t.Error("ListFiles of a nil Tree should fail")
+	}
+	if nilTree.Exists(".") {
+		t.Error("a nil Tree should have no files")
+	}
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+// csvRenderer writes one row per file with the dir it is grouped into. The
+// dir and its existence are empty for a file which is in no dir, e.g. one
+// without a root marker.
+type csvRenderer struct{}
+
+func (csvRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	dirs := make(map[string]changedobjects.Dir)
+	for _, dir := range diff.Dirs {
+		for _, file := range dir.Files {
+			dirs[file.Path] = dir
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"path", "type", "dir", "exist"}); err != nil {
+		return err
+	}
+	for _, file := range diff.Files {
+		record := []string{file.Path, file.Type.String(), "", ""}
+		if dir, ok := dirs[file.Path]; ok {
+			record[2], record[3] = dir.Path, strconv.FormatBool(dir.Exist)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
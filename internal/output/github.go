@@ -0,0 +1,144 @@
+package output
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+const FormatGitHubMatrix = "github-matrix"
+
+// MaxMatrixJobs is the maximum number of jobs a matrix of GitHub Actions
+// can generate.
+const MaxMatrixJobs = 256
+
+// Matrix is a strategy.matrix of GitHub Actions with a job per dir, or per
+// shard if the dirs are sharded.
+type Matrix struct {
+	// Include has the path and the existence of each dir, along with the
+	// labels of its group-by pattern, or the index and the dir paths of
+	// each shard.
+	Include []map[string]any `json:"include"`
+}
+
+// NewMatrix returns the Matrix of the dirs of diff. It fails if there are
+// more jobs than MaxMatrixJobs.
+func NewMatrix(diff changedobjects.Diff) (Matrix, error) {
+	m := Matrix{Include: []map[string]any{}}
+	if len(diff.Dirs) > 0 && diff.Dirs[0].Shard != nil {
+		m.Include = shardEntries(diff.Dirs)
+	} else {
+		for _, dir := range diff.Dirs {
+			entry := map[string]any{}
+			for name, value := range dir.Labels {
+				entry[name] = value
+			}
+			// labels named path or exist do not override them
+			entry["path"] = dir.Path
+			entry["exist"] = dir.Exist
+			m.Include = append(m.Include, entry)
+		}
+	}
+	if len(m.Include) > MaxMatrixJobs {
+		return Matrix{}, fmt.Errorf("%d jobs exceed the limit of %d jobs in a matrix of GitHub Actions, use --shards to run several dirs in a job", len(m.Include), MaxMatrixJobs)
+	}
+	return m, nil
+}
+
+// shardEntries returns an entry with the shard index and the dir paths for
+// each shard having dirs, in the order of the shards.
+func shardEntries(dirs []changedobjects.Dir) []map[string]any {
+	paths := map[int][]string{}
+	for _, dir := range dirs {
+		paths[*dir.Shard] = append(paths[*dir.Shard], dir.Path)
+	}
+	shards := make([]int, 0, len(paths))
+	for shard := range paths {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+
+	entries := make([]map[string]any, 0, len(shards))
+	for _, shard := range shards {
+		entries = append(entries, map[string]any{
+			"shard": shard,
+			"paths": paths[shard],
+		})
+	}
+	return entries
+}
+
+// matrixRenderer writes the Matrix as JSON.
+type matrixRenderer struct{}
+
+func (matrixRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	m, err := NewMatrix(diff)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(m)
+}
+
+// WriteGitHubOutput appends the Matrix of diff and its counts to the file
+// named by $GITHUB_OUTPUT, as the step outputs matrix, dirs, files and
+// has_changes.
+func WriteGitHubOutput(diff changedobjects.Diff) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return fmt.Errorf("GITHUB_OUTPUT is not set")
+	}
+
+	m, err := NewMatrix(diff)
+	if err != nil {
+		return err
+	}
+	matrix, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	outputs := [][2]string{
+		{"matrix", string(matrix)},
+		{"dirs", strconv.Itoa(len(diff.Dirs))},
+		{"files", strconv.Itoa(len(diff.Files))},
+		{"has_changes", strconv.FormatBool(len(diff.Files) > 0)},
+	}
+	for _, output := range outputs {
+		if err := writeGitHubOutput(f, output[0], output[1]); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeGitHubOutput writes a step output in the multiline syntax, with a
+// random delimiter which cannot appear in value.
+func writeGitHubOutput(w io.Writer, name, value string) error {
+	var delimiter string
+	for {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		delimiter = "ghadelimiter_" + hex.EncodeToString(b)
+		if !strings.Contains(value, delimiter) {
+			break
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+	return err
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatrix(t *testing.T) {
+	shard := func(i int) *int { return &i }
+	cases := []struct {
+		name    string
+		diff    changedobjects.Diff
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "dirs",
+			diff: testDiff,
+			want: `{"include":[{"exist":true,"path":"terraform/a"},{"exist":false,"path":"terraform/b"}]}` + "\n",
+		},
+		{
+			name: "labels",
+			diff: changedobjects.Diff{Dirs: []changedobjects.Dir{
+				{Path: "terraform/a/prod", Exist: true, Labels: map[string]string{"service": "a", "env": "prod"}},
+				{Path: "terraform/b/dev", Labels: map[string]string{"path": "b", "exist": "dev"}},
+			}},
+			want: `{"include":[{"env":"prod","exist":true,"path":"terraform/a/prod","service":"a"},{"exist":false,"path":"terraform/b/dev"}]}` + "\n",
+		},
+		{
+			name: "shards",
+			diff: changedobjects.Diff{Dirs: []changedobjects.Dir{
+				{Path: "a", Shard: shard(1)},
+				{Path: "b", Shard: shard(0)},
+				{Path: "c", Shard: shard(1)},
+			}},
+			want: `{"include":[{"paths":["b"],"shard":0},{"paths":["a","c"],"shard":1}]}` + "\n",
+		},
+		{
+			name: "empty",
+			diff: changedobjects.Diff{},
+			want: `{"include":[]}` + "\n",
+		},
+		{
+			name:    "too many dirs",
+			diff:    changedobjects.Diff{Dirs: make([]changedobjects.Dir, MaxMatrixJobs+1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := New(FormatGitHubMatrix, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = r.Render(&buf, tt.diff)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(buf.String(), tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteGitHubOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "github_output")
+	if err := os.WriteFile(path, []byte("previous=step\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_OUTPUT", path)
+
+	if err := WriteGitHubOutput(testDiff); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the delimiters are random
+	got := regexp.MustCompile(`ghadelimiter_[0-9a-f]{32}`).ReplaceAllString(string(data), "EOF")
+	want := strings.Join([]string{
+		"previous=step",
+		"matrix<<EOF",
+		`{"include":[{"exist":true,"path":"terraform/a"},{"exist":false,"path":"terraform/b"}]}`,
+		"EOF",
+		"dirs<<EOF", "2", "EOF",
+		"files<<EOF", "2", "EOF",
+		"has_changes<<EOF", "true", "EOF",
+	}, "\n") + "\n"
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+
+	t.Setenv("GITHUB_OUTPUT", "")
+	if err := WriteGitHubOutput(testDiff); err == nil {
+		t.Error("WriteGitHubOutput should fail without GITHUB_OUTPUT")
+	}
+}
+
+func Test_writeGitHubOutput(t *testing.T) {
+	var buf bytes.Buffer
+	value := "line 1\nline 2"
+	if err := writeGitHubOutput(&buf, "multi", value); err != nil {
+		t.Fatal(err)
+	}
+
+	var name, delimiter string
+	if _, err := fmt.Sscanf(buf.String(), "%s", &name); err != nil {
+		t.Fatal(err)
+	}
+	name, delimiter, _ = strings.Cut(name, "<<")
+	want := fmt.Sprintf("multi<<%s\n%s\n%s\n", delimiter, value, delimiter)
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+	if name != "multi" || !strings.HasPrefix(delimiter, "ghadelimiter_") {
+		t.Errorf("unexpected name %q or delimiter %q", name, delimiter)
+	}
+}
@@ -0,0 +1,37 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+// markdownRenderer writes a table of the dirs with the number of their
+// files by type of change.
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	var b strings.Builder
+	b.WriteString("| Dir | Added | Deleted | Modified | Total |\n")
+	b.WriteString("|---|--:|--:|--:|--:|\n")
+
+	var total [changedobjects.Unknown + 1]int
+	for _, dir := range diff.Dirs {
+		var counts [changedobjects.Unknown + 1]int
+		for _, file := range dir.Files {
+			counts[file.Type]++
+			total[file.Type]++
+		}
+		path := "`" + strings.ReplaceAll(dir.Path, "|", `\|`) + "`"
+		if !dir.Exist {
+			path += " (not exist)"
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %d |\n", path, counts[changedobjects.Addition], counts[changedobjects.Deletion], counts[changedobjects.Modification], len(dir.Files))
+	}
+	fmt.Fprintf(&b, "| **Total** | %d | %d | %d | %d |\n", total[changedobjects.Addition], total[changedobjects.Deletion], total[changedobjects.Modification], total[changedobjects.Addition]+total[changedobjects.Deletion]+total[changedobjects.Modification]+total[changedobjects.Unknown])
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
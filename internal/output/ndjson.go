@@ -0,0 +1,47 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+const FormatNDJSON = "ndjson"
+
+// EntryRenderer is a Renderer which can also write the files and dirs one
+// by one, as they are produced by detect's Walk.
+type EntryRenderer interface {
+	Renderer
+	RenderEntry(w io.Writer, entry changedobjects.Entry) error
+}
+
+// ndjsonRenderer writes a line of JSON per file and per dir, as
+// {"file":{...}} or {"dir":{...}}.
+type ndjsonRenderer struct {
+	selection string
+}
+
+func (r ndjsonRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	for i := range diff.Files {
+		if err := r.RenderEntry(w, changedobjects.Entry{File: &diff.Files[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range diff.Dirs {
+		if err := r.RenderEntry(w, changedobjects.Entry{Dir: &diff.Dirs[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r ndjsonRenderer) RenderEntry(w io.Writer, entry changedobjects.Entry) error {
+	switch {
+	case entry.File != nil && r.selection == SelectDirs:
+		return nil
+	case entry.Dir != nil && r.selection == SelectFiles:
+		return nil
+	}
+	return json.NewEncoder(w).Encode(entry)
+}
@@ -0,0 +1,176 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatText     = "text"
+	FormatNull     = "null"
+	FormatLines    = "lines"
+	FormatYAML     = "yaml"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+const (
+	SelectFiles = "files"
+	SelectDirs  = "dirs"
+)
+
+// Renderer writes a Diff in some format.
+type Renderer interface {
+	Render(w io.Writer, diff changedobjects.Diff) error
+}
+
+// formats returns the Renderer of each format for a selection.
+var formats = map[string]func(selection string) Renderer{
+	FormatJSON: func(selection string) Renderer {
+		return jsonRenderer{selection: selection}
+	},
+	FormatText: func(selection string) Renderer {
+		return textRenderer{files: selection == SelectFiles}
+	},
+	FormatNull: func(selection string) Renderer {
+		return pathsRenderer{files: selection == SelectFiles, sep: "\x00"}
+	},
+	FormatLines: func(selection string) Renderer {
+		return pathsRenderer{files: selection == SelectFiles, sep: "\n"}
+	},
+	FormatYAML: func(selection string) Renderer {
+		return yamlRenderer{selection: selection}
+	},
+	FormatCSV: func(string) Renderer {
+		return csvRenderer{}
+	},
+	FormatMarkdown: func(string) Renderer {
+		return markdownRenderer{}
+	},
+	FormatNDJSON: func(selection string) Renderer {
+		return ndjsonRenderer{selection: selection}
+	},
+	FormatTree: func(string) Renderer {
+		return treeRenderer{}
+	},
+	FormatTreeJSON: func(string) Renderer {
+		return treeJSONRenderer{}
+	},
+	FormatGitHubMatrix: func(string) Renderer {
+		return matrixRenderer{}
+	},
+}
+
+// Formats returns the names of the supported formats in sorted order.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the Renderer of format. selection chooses whether files or
+// dirs are written; if empty, JSON, NDJSON and YAML write the whole Diff
+// and the line formats write the dirs. CSV always writes the files,
+// Markdown, the trees and the GitHub matrix the dirs.
+func New(format, selection string) (Renderer, error) {
+	switch selection {
+	case "", SelectFiles, SelectDirs:
+	default:
+		return nil, fmt.Errorf("invalid selection: %q (expected %s or %s)", selection, SelectFiles, SelectDirs)
+	}
+
+	if format == "" {
+		format = FormatJSON
+	}
+	newRenderer, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("invalid output format: %q (expected one of %s)", format, strings.Join(Formats(), ", "))
+	}
+	return newRenderer(selection), nil
+}
+
+// jsonRenderer writes the Diff, or its files or dirs, as JSON.
+type jsonRenderer struct {
+	selection string
+}
+
+func (r jsonRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	enc := json.NewEncoder(w)
+	switch r.selection {
+	case SelectFiles:
+		return enc.Encode(diff.Files)
+	case SelectDirs:
+		return enc.Encode(diff.Dirs)
+	}
+	return enc.Encode(&diff)
+}
+
+// pathsRenderer writes the path of each file or dir followed by sep.
+type pathsRenderer struct {
+	files bool
+	sep   string
+}
+
+func (r pathsRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	for _, path := range paths(diff, r.files) {
+		if _, err := io.WriteString(w, path+r.sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func paths(diff changedobjects.Diff, files bool) []string {
+	var paths []string
+	if files {
+		for _, file := range diff.Files {
+			paths = append(paths, file.Path)
+		}
+		return paths
+	}
+	for _, dir := range diff.Dirs {
+		paths = append(paths, dir.Path)
+	}
+	return paths
+}
+
+// textRenderer writes a human readable list of the files, or of the dirs
+// with their files.
+type textRenderer struct {
+	files bool
+}
+
+func (r textRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	if r.files {
+		for _, file := range diff.Files {
+			if _, err := fmt.Fprintf(w, "%-8s  %s\n", file.Type, file.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, dir := range diff.Dirs {
+		state := ""
+		if !dir.Exist {
+			state = " (not exist)"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", dir.Path, state); err != nil {
+			return err
+		}
+		for _, file := range dir.Files {
+			if _, err := fmt.Fprintf(w, "  %-8s  %s\n", file.Type, file.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
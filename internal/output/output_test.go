@@ -0,0 +1,156 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var testDiff = changedobjects.Diff{
+	Files: []changedobjects.File{
+		{Name: "main.tf", Path: "terraform/a/main.tf", Type: changedobjects.Modification, ParentDir: changedobjects.ParentDir{Path: "terraform/a", Exist: true}},
+		{Name: "main.tf", Path: "terraform/b/main.tf", Type: changedobjects.Deletion, ParentDir: changedobjects.ParentDir{Path: "terraform/b"}},
+	},
+	Dirs: []changedobjects.Dir{
+		{
+			Path:  "terraform/a",
+			Exist: true,
+			Files: []changedobjects.File{
+				{Name: "main.tf", Path: "terraform/a/main.tf", Type: changedobjects.Modification, ParentDir: changedobjects.ParentDir{Path: "terraform/a", Exist: true}},
+			},
+		},
+		{
+			Path: "terraform/b",
+			Files: []changedobjects.File{
+				{Name: "main.tf", Path: "terraform/b/main.tf", Type: changedobjects.Deletion, ParentDir: changedobjects.ParentDir{Path: "terraform/b"}},
+			},
+		},
+	},
+}
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name      string
+		format    string
+		selection string
+		want      string
+	}{
+		{
+			name:   "json",
+			format: FormatJSON,
+			want:   `{"files":[{"name":"main.tf","path":"terraform/a/main.tf","type":"modified","parent_dir":{"path":"terraform/a","exist":true}},{"name":"main.tf","path":"terraform/b/main.tf","type":"deleted","parent_dir":{"path":"terraform/b","exist":false}}],"dirs":[{"path":"terraform/a","exist":true,"files":[{"name":"main.tf","path":"terraform/a/main.tf","type":"modified","parent_dir":{"path":"terraform/a","exist":true}}]},{"path":"terraform/b","exist":false,"files":[{"name":"main.tf","path":"terraform/b/main.tf","type":"deleted","parent_dir":{"path":"terraform/b","exist":false}}]}]}` + "\n",
+		},
+		{
+			name:      "json dirs",
+			format:    FormatJSON,
+			selection: SelectDirs,
+			want:      `[{"path":"terraform/a","exist":true,"files":[{"name":"main.tf","path":"terraform/a/main.tf","type":"modified","parent_dir":{"path":"terraform/a","exist":true}}]},{"path":"terraform/b","exist":false,"files":[{"name":"main.tf","path":"terraform/b/main.tf","type":"deleted","parent_dir":{"path":"terraform/b","exist":false}}]}]` + "\n",
+		},
+		{
+			name:   "lines of dirs by default",
+			format: FormatLines,
+			want:   "terraform/a\nterraform/b\n",
+		},
+		{
+			name:      "lines of files",
+			format:    FormatLines,
+			selection: SelectFiles,
+			want:      "terraform/a/main.tf\nterraform/b/main.tf\n",
+		},
+		{
+			name:   "null",
+			format: FormatNull,
+			want:   "terraform/a\x00terraform/b\x00",
+		},
+		{
+			name:   "text",
+			format: FormatText,
+			want: "terraform/a\n" +
+				"  modified  terraform/a/main.tf\n" +
+				"terraform/b (not exist)\n" +
+				"  deleted   terraform/b/main.tf\n",
+		},
+		{
+			name:      "text files",
+			format:    FormatText,
+			selection: SelectFiles,
+			want:      "modified  terraform/a/main.tf\ndeleted   terraform/b/main.tf\n",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := New(tt.format, tt.selection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := r.Render(&buf, testDiff); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(buf.String(), tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := New("xml", ""); err == nil {
+		t.Error("New should fail for an unknown format")
+	}
+}
+
+// TestRender_golden compares the output of each format with
+// testdata/<name>.golden. Run with -update to rewrite them.
+func TestRender_golden(t *testing.T) {
+	cases := []struct {
+		name      string
+		format    string
+		selection string
+	}{
+		{name: "yaml", format: FormatYAML},
+		{name: "yaml-files", format: FormatYAML, selection: SelectFiles},
+		{name: "csv", format: FormatCSV},
+		{name: "markdown", format: FormatMarkdown},
+		{name: "ndjson", format: FormatNDJSON},
+		{name: "ndjson-dirs", format: FormatNDJSON, selection: SelectDirs},
+		{name: "tree", format: FormatTree},
+		{name: "tree-json", format: FormatTreeJSON},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.format, tt.selection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := r.Render(&buf, testDiff); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(buf.String(), string(want)); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+// funcs are the functions available in templates in addition to the
+// builtin ones.
+var funcs = template.FuncMap{
+	// join concatenates elems with sep, e.g. {{paths .Dirs | join " "}}
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"base": path.Base,
+	"dir":  path.Dir,
+	// paths returns the paths of files or dirs
+	"paths": func(v any) ([]string, error) {
+		var paths []string
+		switch v := v.(type) {
+		case []changedobjects.File:
+			for _, file := range v {
+				paths = append(paths, file.Path)
+			}
+		case []changedobjects.Dir:
+			for _, dir := range v {
+				paths = append(paths, dir.Path)
+			}
+		default:
+			return nil, fmt.Errorf("paths: unsupported type %T", v)
+		}
+		return paths, nil
+	},
+	"toJson": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+	// label returns the value of a placeholder of the group-by pattern of
+	// dir, or an empty string
+	"label": func(dir changedobjects.Dir, name string) string {
+		return dir.Labels[name]
+	},
+}
+
+// templateRenderer executes a text/template with the Diff as its data.
+type templateRenderer struct {
+	tmpl *template.Template
+}
+
+// NewTemplate returns a Renderer executing text as a text/template.
+func NewTemplate(text string) (Renderer, error) {
+	return parseTemplate("template", text)
+}
+
+// NewTemplateFile returns a Renderer executing the template in the file at
+// path.
+func NewTemplateFile(path string) (Renderer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseTemplate(filepath.Base(path), string(data))
+}
+
+func parseTemplate(name, text string) (Renderer, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return templateRenderer{tmpl: tmpl}, nil
+}
+
+func (r templateRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	return r.tmpl.Execute(w, diff)
+}
@@ -0,0 +1,69 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTemplate(t *testing.T) {
+	diff := testDiff
+	diff.Dirs = append([]changedobjects.Dir(nil), testDiff.Dirs...)
+	diff.Dirs[0].Labels = map[string]string{"service": "a"}
+
+	cases := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "range",
+			text: `{{range .Dirs}}{{.Path}}:{{len .Files}}{{"\n"}}{{end}}`,
+			want: "terraform/a:1\nterraform/b:1\n",
+		},
+		{
+			name: "paths and join",
+			text: `{{paths .Files | join " "}}`,
+			want: "terraform/a/main.tf terraform/b/main.tf",
+		},
+		{
+			name: "base and dir",
+			text: `{{range .Files}}{{base .Path}} in {{dir .Path}};{{end}}`,
+			want: "main.tf in terraform/a;main.tf in terraform/b;",
+		},
+		{
+			name: "toJson",
+			text: `{{toJson (paths .Dirs)}}`,
+			want: `["terraform/a","terraform/b"]`,
+		},
+		{
+			name: "label",
+			text: `{{range .Dirs}}[{{label . "service"}}]{{end}}`,
+			want: "[a][]",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := NewTemplate(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := r.Render(&buf, diff); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(buf.String(), tt.want); diff != "" {
+				t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := NewTemplate("{{.Dirs"); err == nil {
+		t.Error("NewTemplate should fail for a malformed template")
+	}
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/babarot/changed-objects/changedobjects"
+)
+
+const (
+	FormatTree     = "tree"
+	FormatTreeJSON = "tree-json"
+)
+
+// Counts are the numbers of changed files by type of change.
+type Counts struct {
+	Added    int `json:"added"`
+	Deleted  int `json:"deleted"`
+	Modified int `json:"modified"`
+	Total    int `json:"total"`
+}
+
+func (c *Counts) add(files []changedobjects.File) {
+	for _, file := range files {
+		switch file.Type {
+		case changedobjects.Addition:
+			c.Added++
+		case changedobjects.Deletion:
+			c.Deleted++
+		case changedobjects.Modification:
+			c.Modified++
+		}
+		c.Total++
+	}
+}
+
+func (c Counts) String() string {
+	var s []string
+	for _, n := range []struct {
+		sign  string
+		count int
+	}{{"+", c.Added}, {"-", c.Deleted}, {"~", c.Modified}} {
+		if n.count > 0 {
+			s = append(s, fmt.Sprintf("%s%d", n.sign, n.count))
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// TreeNode is a directory in the tree of the dirs of a Diff.
+type TreeNode struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Dir reports whether the node is one of the dirs of the Diff rather
+	// than only an ancestor of some of them.
+	Dir bool `json:"dir"`
+	// Exist is the existence of the dir, if Dir is true.
+	Exist *bool `json:"exist,omitempty"`
+	// Counts are the numbers of the files of the dir and of all the dirs
+	// below it.
+	Counts   Counts      `json:"counts"`
+	Children []*TreeNode `json:"children"`
+}
+
+// NewTree nests the dirs of diff into a tree rooted at ".", with the
+// children of each node sorted by name.
+func NewTree(diff changedobjects.Diff) *TreeNode {
+	root := &TreeNode{Name: ".", Path: ".", Children: []*TreeNode{}}
+	for _, dir := range diff.Dirs {
+		node := root
+		node.Counts.add(dir.Files)
+		if dir.Path != "." {
+			for _, name := range strings.Split(dir.Path, "/") {
+				node = node.child(name)
+				node.Counts.add(dir.Files)
+			}
+		}
+		exist := dir.Exist
+		node.Dir = true
+		node.Exist = &exist
+	}
+	root.sort()
+	return root
+}
+
+func (n *TreeNode) child(name string) *TreeNode {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	path := name
+	if n.Path != "." {
+		path = n.Path + "/" + name
+	}
+	child := &TreeNode{Name: name, Path: path, Children: []*TreeNode{}}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+func (n *TreeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
+
+// treeJSONRenderer writes the tree of the dirs as JSON.
+type treeJSONRenderer struct{}
+
+func (treeJSONRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	return json.NewEncoder(w).Encode(NewTree(diff))
+}
+
+// treeRenderer draws the tree of the dirs with the counts of each node, e.g.
+//
+//	.  +1 ~2
+//	└── terraform  +1 ~2
+//	    ├── a  ~2
+//	    └── b (not exist)  +1
+type treeRenderer struct{}
+
+func (treeRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	var b strings.Builder
+	root := NewTree(diff)
+	writeTreeLine(&b, "", root)
+	writeTreeChildren(&b, "", root)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTreeChildren(b *strings.Builder, indent string, n *TreeNode) {
+	for i, child := range n.Children {
+		branch, next := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+		writeTreeLine(b, indent+branch, child)
+		writeTreeChildren(b, indent+next, child)
+	}
+}
+
+func writeTreeLine(b *strings.Builder, prefix string, n *TreeNode) {
+	b.WriteString(prefix + n.Name)
+	if n.Exist != nil && !*n.Exist {
+		b.WriteString(" (not exist)")
+	}
+	if counts := n.Counts.String(); counts != "" {
+		b.WriteString("  " + counts)
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,48 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTree(t *testing.T) {
+	file := func(path string, ty changedobjects.ChangeType) changedobjects.File {
+		return changedobjects.File{Path: path, Type: ty}
+	}
+	diff := changedobjects.Diff{Dirs: []changedobjects.Dir{
+		{Path: "x/y", Exist: true, Files: []changedobjects.File{file("x/y/b.go", changedobjects.Addition)}},
+		{Path: ".", Exist: true, Files: []changedobjects.File{file("go.mod", changedobjects.Modification)}},
+		{Path: "x", Exist: true, Files: []changedobjects.File{file("x/a.go", changedobjects.Modification), file("x/c.go", changedobjects.Unknown)}},
+		{Path: "w/z", Files: []changedobjects.File{file("w/z/d.go", changedobjects.Deletion)}},
+	}}
+
+	var buf bytes.Buffer
+	if err := (treeRenderer{}).Render(&buf, diff); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		".  +1 -1 ~2\n" +
+		"├── w  -1\n" +
+		"│   └── z (not exist)  -1\n" +
+		"└── x  +1 ~1\n" +
+		"    └── y  +1\n"
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+
+	root := NewTree(diff)
+	got := []Counts{root.Counts, root.Children[1].Counts}
+	wantCounts := []Counts{
+		{Added: 1, Deleted: 1, Modified: 2, Total: 5},
+		{Added: 1, Modified: 1, Total: 3},
+	}
+	if diff := cmp.Diff(got, wantCounts); diff != "" {
+		t.Errorf("Result is mismatch (-got +want):\n%s", diff)
+	}
+	if !root.Dir || root.Children[0].Dir || !root.Children[1].Dir {
+		t.Errorf("unexpected dir nodes: %v, %v, %v", root.Dir, root.Children[0].Dir, root.Children[1].Dir)
+	}
+}
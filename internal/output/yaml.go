@@ -0,0 +1,52 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlRenderer writes the Diff, or its files or dirs, as YAML with the same
+// keys as JSON.
+type yamlRenderer struct {
+	selection string
+}
+
+func (r yamlRenderer) Render(w io.Writer, diff changedobjects.Diff) error {
+	var v any = &diff
+	switch r.selection {
+	case SelectFiles:
+		v = diff.Files
+	case SelectDirs:
+		v = diff.Dirs
+	}
+
+	// go through JSON so that the keys follow the json tags, and decode it
+	// into a node so that their order is kept
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle clears the flow style and the quotes that node has from JSON.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
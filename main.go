@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,8 +12,10 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/babarot/changed-objects/internal/detect"
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/babarot/changed-objects/internal/output"
 	"github.com/hashicorp/logutils"
 	"github.com/jessevdk/go-flags"
 )
@@ -20,23 +25,100 @@ var (
 	Revision = "unset"
 )
 
+// Exit statuses of the command, mirroring git diff --exit-code.
+const (
+	// ExitOK is returned on success, including --help. With --exit-code, it
+	// also means nothing changed.
+	ExitOK = 0
+	// ExitChanges is returned with --exit-code or --quiet when there are
+	// changes.
+	ExitChanges = 1
+	// ExitError is returned on errors.
+	ExitError = 2
+)
+
+// errChanges is returned by run to exit with ExitChanges.
+var errChanges = errors.New("changes found")
+
 type Option struct {
 	Version bool `short:"v" long:"version" description:"Show version"`
 
-	DefaultBranch string   `long:"default-branch" short:"b" description:"Specify default branch name" default:"main"`
-	MergeBase     string   `long:"merge-base" short:"m" description:"Specify a Git reference as good common ancestors as possible for a merge"`
-	Types         []string `long:"type" description:"Specify the type of changed objects" choice:"added" choice:"modified" choice:"deleted"`
-	Ignores       []string `long:"ignore" description:"Specify a pattern to skip when showing changed objects"`
-	GroupBy       []string `long:"group-by" description:"Specify a pattern to make into one group when showing changed objects"`
-	DirExist      string   `long:"dir-exist" description:"Filter objects by state of dir existing" choice:"true" choice:"false" choice:"all" default:"all"`
-	RootMarker    string   `long:"root-marker" description:"Specify a glob pattern of file that marks the root directory (e.g. *.tf)"`
+	Config  string `long:"config" description:"Specify a configuration file (default: .changed-objects.yaml in the repository root)"`
+	Profile string `long:"profile" description:"Specify a profile defined in the configuration file"`
+
+	DefaultBranch      string   `long:"default-branch" short:"b" description:"Specify default branch name" default:"main"`
+	MergeBase          string   `long:"merge-base" short:"m" description:"Specify a Git reference as good common ancestors as possible for a merge"`
+	Types              []string `long:"type" description:"Specify the type of changed objects" choice:"added" choice:"modified" choice:"deleted"`
+	Includes           []string `long:"include" description:"Specify a glob pattern matched against file paths to select changed objects (e.g. **/*.tf)"`
+	Ignores            []string `long:"ignore" description:"Specify a gitignore-style pattern to skip when showing changed objects"`
+	IgnoreFile         string   `long:"ignore-file" description:"Specify a gitignore-style file of patterns to skip (default: .changedignore in the repository root)"`
+	GroupBy            []string `long:"group-by" description:"Specify a pattern to make into one group when showing changed objects (prefix with N: to set a priority)"`
+	GroupByMatch       string   `long:"group-by-match" description:"Choose the shortest or longest directory matched by group-by patterns" choice:"shortest" choice:"longest" default:"shortest"`
+	Depth              int      `long:"depth" description:"Group changes by their ancestor at the given depth instead of group-by patterns"`
+	DepthFrom          string   `long:"depth-from" description:"Count the depth of --depth below the given directory"`
+	Collapse           string   `long:"collapse" description:"Merge dirs nested in other dirs into their topmost ancestor, or keep only the nested ones" choice:"ancestor" choice:"descendant" choice:"none" default:"none"`
+	DirExist           string   `long:"dir-exist" description:"Filter objects by state of dir existing" choice:"true" choice:"false" choice:"all" default:"all"`
+	RootMarkers        []string `long:"root-marker" description:"Specify a glob pattern of file that marks the root directory, optionally followed by :regex matched against its content (e.g. *.tf, package.json:\"workspaces\")"`
+	RootMarkerCeiling  string   `long:"root-marker-ceiling" description:"Do not look up root markers above the given directory (default: the repository root)"`
+	RootMarkerMaxDepth int      `long:"root-marker-max-depth" description:"Look up root markers in at most the given number of directories from the changed one (default: no limit)"`
+	ExistFrom          string   `long:"exist-from" description:"Check the existence of dirs and root markers in the working tree, or in the tree of HEAD" choice:"worktree" choice:"head" default:"worktree"`
+	Sort               string   `long:"sort" description:"Order files and dirs by path, type of change, size or number of changes" choice:"path" choice:"type" choice:"size" choice:"changes" default:"path"`
+	Reverse            bool     `long:"reverse" description:"Reverse the order of files and dirs"`
+	Shards             int      `long:"shards" description:"Partition dirs into the given number of shards balanced by their number of files"`
+	ShardIndex         int      `long:"shard-index" description:"Output only the dirs in the given shard, from 0 to the number of shards minus one" default:"-1"`
+	ShardWeights       []string `long:"shard-weight" description:"Weigh the dirs matching a glob pattern for --shards, as <pattern>=<weight>"`
+	ChangesFrom        string   `long:"changes-from" description:"Read changes from a file (or - for stdin) instead of comparing git commits"`
+
+	Output string `long:"output" short:"o" description:"Specify the output format" choice:"json" choice:"yaml" choice:"text" choice:"null" choice:"lines" choice:"csv" choice:"markdown" choice:"ndjson" choice:"tree" choice:"tree-json" choice:"github-matrix" default:"json"`
+	Select string `long:"select" description:"Output only the files or the dirs (default: the whole result for json, dirs otherwise)" choice:"files" choice:"dirs"`
+
+	GitHubOutput bool `long:"github-output" description:"Also write the matrix of dirs and the counts of changes to the file named by $GITHUB_OUTPUT"`
+
+	Template     string `long:"template" description:"Output the result with a Go text/template instead of --output"`
+	TemplateFile string `long:"template-file" description:"Output the result with the Go text/template in the given file instead of --output"`
+
+	Timeout time.Duration `long:"timeout" description:"Give up after the given duration (e.g. 30s, 5m)"`
+	Explain bool          `long:"explain" description:"Show why each changed file was included, excluded or grouped instead of the result"`
+
+	ExitCode bool `long:"exit-code" description:"Exit with 1 if there are changes and 0 otherwise"`
+	Quiet    bool `short:"q" long:"quiet" description:"Output nothing, implies --exit-code"`
+}
+
+func newParser(opt *Option) *flags.Parser {
+	p := flags.NewParser(opt, flags.HelpFlag|flags.PassDoubleDash)
+	p.SubcommandsOptional = true
+	_, err := p.AddCommand("config", "Manage the configuration file", "", &configCommand{})
+	if err != nil {
+		panic(err)
+	}
+	return p
 }
 
 func main() {
-	if err := run(os.Args[1:]); err != nil {
+	err := run(os.Args[1:])
+	status := exitStatus(err)
+	switch {
+	case status == ExitOK && err != nil:
+		// the help message
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+	case status == ExitError:
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
 	}
+	os.Exit(status)
+}
+
+// exitStatus returns the exit status for the error returned by run.
+func exitStatus(err error) int {
+	var flagsErr *flags.Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errChanges):
+		return ExitChanges
+	case errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp:
+		return ExitOK
+	}
+	return ExitError
 }
 
 func run(args []string) error {
@@ -56,8 +138,8 @@ func run(args []string) error {
 	log.Printf("[INFO] Args: %#v", args)
 
 	var opt Option
-	p := flags.NewParser(&opt, flags.HelpFlag|flags.PassDoubleDash)
-	args, err = p.ParseArgs(args)
+	p := newParser(&opt)
+	rest, err := p.ParseArgs(args)
 	if err != nil {
 		return err
 	}
@@ -79,25 +161,199 @@ func run(args []string) error {
 	}
 	log.Printf("[INFO] git repo: %s", repo)
 
-	d, err := detect.New(repo, args, detect.Option{
-		DefaultBranch: opt.DefaultBranch,
-		MergeBase:     opt.MergeBase,
-		Ignores:       opt.Ignores,
-		GroupBy:       opt.GroupBy,
-		Types:         opt.Types,
-		DirExist:      opt.DirExist,
-		RootMarker:    opt.RootMarker,
-	})
+	cfg, err := loadConfig(repo, opt.Config)
 	if err != nil {
 		return err
 	}
 
-	diff, err := d.Run()
+	if p.Active != nil && p.Active.Name == "config" {
+		return validateConfig(cfg)
+	}
+
+	if cfg != nil {
+		cfgArgs, err := configArgs(p, cfg, opt.Profile)
+		if err != nil {
+			return err
+		}
+		if len(cfgArgs) > 0 {
+			log.Printf("[INFO] Args from %s: %#v", cfg.Path, cfgArgs)
+			// parse again so that flags given on the command line win over
+			// the ones from the configuration file
+			opt = Option{}
+			rest, err = newParser(&opt).ParseArgs(append(cfgArgs, args...))
+			if err != nil {
+				return fmt.Errorf("%s: %w", cfg.Path, err)
+			}
+		}
+	} else if opt.Profile != "" {
+		return fmt.Errorf("--profile %q is given but no configuration file is found", opt.Profile)
+	}
+	args = rest
+
+	types := make([]changedobjects.ChangeType, 0, len(opt.Types))
+	for _, ty := range opt.Types {
+		t, err := changedobjects.ParseChangeType(ty)
+		if err != nil {
+			return err
+		}
+		types = append(types, t)
+	}
+
+	opts := []changedobjects.Option{
+		changedobjects.WithDefaultBranch(opt.DefaultBranch),
+		changedobjects.WithMergeBase(opt.MergeBase),
+		changedobjects.WithPaths(args...),
+		changedobjects.WithTypes(types...),
+		changedobjects.WithIncludes(opt.Includes...),
+		changedobjects.WithIgnores(opt.Ignores...),
+		changedobjects.WithIgnoreFile(ignoreFile(repo, opt.IgnoreFile)),
+		changedobjects.WithGroupBy(opt.GroupBy...),
+		changedobjects.WithGroupByMatch(changedobjects.GroupByMatch(opt.GroupByMatch)),
+		changedobjects.WithDepth(opt.Depth),
+		changedobjects.WithDepthFrom(opt.DepthFrom),
+		changedobjects.WithCollapse(changedobjects.Collapse(opt.Collapse)),
+		changedobjects.WithDirExist(changedobjects.DirExist(opt.DirExist)),
+		changedobjects.WithRootMarker(opt.RootMarkers...),
+		changedobjects.WithRootMarkerCeiling(opt.RootMarkerCeiling),
+		changedobjects.WithRootMarkerMaxDepth(opt.RootMarkerMaxDepth),
+		changedobjects.WithExistFrom(changedobjects.ExistFrom(opt.ExistFrom)),
+		changedobjects.WithSort(changedobjects.SortKey(opt.Sort)),
+		changedobjects.WithReverse(opt.Reverse),
+		changedobjects.WithShards(opt.Shards),
+		changedobjects.WithShardWeight(opt.ShardWeights...),
+	}
+	if opt.ShardIndex >= 0 {
+		opts = append(opts, changedobjects.WithShardIndex(opt.ShardIndex))
+	}
+
+	if opt.ChangesFrom != "" {
+		changes, err := readChanges(opt.ChangesFrom)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] read %d changes from %s", len(changes), opt.ChangesFrom)
+		opts = append(opts, changedobjects.WithChanges(changes))
+	}
+
+	d, err := changedobjects.New(repo, opts...)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := newRenderer(opt)
 	if err != nil {
 		return err
 	}
 
-	return json.NewEncoder(os.Stdout).Encode(&diff)
+	ctx := context.Background()
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	if opt.Explain {
+		if opt.ExitCode || opt.Quiet {
+			return errors.New("--explain cannot be used with --exit-code or --quiet")
+		}
+		if opt.Output != output.FormatJSON || opt.Template != "" || opt.TemplateFile != "" {
+			return fmt.Errorf("--explain only supports --output=%s", output.FormatJSON)
+		}
+		explanations, err := d.Explain(ctx)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(explanations)
+	}
+
+	// --github-output needs all the dirs anyway
+	if r, ok := renderer.(output.EntryRenderer); ok && !opt.Quiet && !opt.GitHubOutput {
+		return stream(ctx, d, r, opt.ExitCode)
+	}
+
+	diff, err := d.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opt.GitHubOutput {
+		if err := output.WriteGitHubOutput(diff); err != nil {
+			return err
+		}
+	}
+
+	if !opt.Quiet {
+		if err := renderer.Render(os.Stdout, diff); err != nil {
+			return err
+		}
+	}
+	if (opt.ExitCode || opt.Quiet) && len(diff.Files) > 0 {
+		return errChanges
+	}
+	return nil
+}
+
+// stream writes the files and dirs one by one as d walks them, without
+// building a Diff and encoding it at once.
+func stream(ctx context.Context, d *changedobjects.Detector, r output.EntryRenderer, exitCode bool) error {
+	w := bufio.NewWriter(os.Stdout)
+	changed := false
+	err := d.Walk(ctx, func(entry changedobjects.Entry) error {
+		if entry.File != nil {
+			changed = true
+		}
+		return r.RenderEntry(w, entry)
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if exitCode && changed {
+		return errChanges
+	}
+	return nil
+}
+
+// newRenderer returns the Renderer of the template given with --template or
+// --template-file, or of --output.
+func newRenderer(opt Option) (output.Renderer, error) {
+	switch {
+	case opt.Template != "" && opt.TemplateFile != "":
+		return nil, errors.New("--template and --template-file cannot be used together")
+	case opt.Template != "":
+		return output.NewTemplate(opt.Template)
+	case opt.TemplateFile != "":
+		return output.NewTemplateFile(opt.TemplateFile)
+	}
+	return output.New(opt.Output, opt.Select)
+}
+
+// ignoreFile returns path, or the ignore file in the repository root if
+// path is empty and the file exists.
+func ignoreFile(repo, path string) string {
+	if path != "" {
+		return path
+	}
+	path = filepath.Join(repo, changedobjects.IgnoreFileName)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	log.Printf("[INFO] ignore file: %s", path)
+	return path
+}
+
+func readChanges(path string) ([]changedobjects.Change, error) {
+	if path == "-" {
+		return changedobjects.ParseChanges(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return changedobjects.ParseChanges(f)
 }
 
 var ValidLevels = []logutils.LogLevel{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babarot/changed-objects/changedobjects"
+	"github.com/jessevdk/go-flags"
+)
+
+func Test_exitStatus(t *testing.T) {
+	var opt Option
+	_, helpErr := newParser(&opt).ParseArgs([]string{"--help"})
+	_, flagErr := newParser(&opt).ParseArgs([]string{"--bogus"})
+	if helpErr == nil || flagErr == nil {
+		t.Fatalf("ParseArgs should fail for --help and --bogus, got %v and %v", helpErr, flagErr)
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", err: nil, want: ExitOK},
+		{name: "help", err: helpErr, want: ExitOK},
+		{name: "changes", err: errChanges, want: ExitChanges},
+		{name: "wrapped changes", err: fmt.Errorf("run: %w", errChanges), want: ExitChanges},
+		{name: "unknown flag", err: flagErr, want: ExitError},
+		{name: "other flag error", err: &flags.Error{Type: flags.ErrRequired}, want: ExitError},
+		{name: "error", err: errors.New("failed"), want: ExitError},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := exitStatus(tt.err); got != tt.want {
+				t.Errorf("exitStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ignoreFile(t *testing.T) {
+	withFile := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withFile, changedobjects.IgnoreFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withoutFile := t.TempDir()
+
+	cases := []struct {
+		name string
+		repo string
+		path string
+		want string
+	}{
+		{name: "found in the repository root", repo: withFile, want: filepath.Join(withFile, changedobjects.IgnoreFileName)},
+		{name: "not found", repo: withoutFile, want: ""},
+		{name: "given", repo: withFile, path: "other.ignore", want: "other.ignore"},
+		{name: "given without a file in the root", repo: withoutFile, path: "other.ignore", want: "other.ignore"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ignoreFile(tt.repo, tt.path); got != tt.want {
+				t.Errorf("ignoreFile(%q, %q) = %q, want %q", tt.repo, tt.path, got, tt.want)
+			}
+		})
+	}
+}